@@ -0,0 +1,144 @@
+package containers
+
+import "time"
+
+// Шаблон метода пакетной загрузки объектов, отсутствующих в хранилище (см. GetOrCreateMany).
+// Возвращает найденные объекты по ключам, ключи ненайденных объектов в результат не включаются
+type BatchLoadMethod = TypedBatchLoadMethod[interface{}, interface{}]
+
+// Типизированный вариант BatchLoadMethod для TypedCache
+type TypedBatchLoadMethod[K comparable, V any] func(keys []K) (map[K]V, error)
+
+// Распределение ключей по сегментам хранилища (индекс результата соответствует номеру сегмента)
+func (s *cache[K, V]) groupKeys(keys []K) [][]K {
+	res := make([][]K, len(s.shards))
+	if len(s.shards) == 1 {
+		res[0] = keys
+		return res
+	}
+	for _, key := range keys {
+		i := s.shardIndex(key)
+		res[i] = append(res[i], key)
+	}
+	return res
+}
+
+// Поиск объектов по списку ключей. Каждый сегмент блокируется однократно для всех относящихся к нему ключей.
+// Возвращает найденные объекты (ключи отсутствующих объектов в результат не включаются)
+func (s *cache[K, V]) GetMany(keys []K, cCall TypedCheckMethod[V]) map[K]V {
+	res := make(map[K]V, len(keys))
+	var refresh, expired []K
+	for i, group := range s.groupKeys(keys) {
+		if len(group) == 0 {
+			continue
+		}
+		shard := s.shards[i]
+		shard.locker.RLock()
+		remove := shard.removeOnGet
+		for _, key := range group {
+			val, check, state := shard.get(key, cCall)
+			s.stats.lookup(check)
+			if check {
+				res[key] = val
+			}
+			if state == itemRefresh {
+				refresh = append(refresh, key)
+			} else if state == itemExpired && remove {
+				expired = append(expired, key)
+			}
+		}
+		shard.locker.RUnlock()
+		if len(expired) > 0 {
+			shard.locker.Lock()
+			now := shard.clock.Now().UnixNano()
+			for _, key := range expired {
+				if shard.expire(key, now) {
+					s.stats.expire(1)
+				}
+			}
+			shard.unlock()
+			expired = expired[:0]
+		}
+	}
+	if loader := s.defaultLoader(); loader != nil {
+		for _, key := range refresh {
+			s.refresh(key, loader, nil)
+		}
+	}
+	return res
+}
+
+// Установка объектов по ключам. Каждый сегмент блокируется однократно для всех относящихся к нему объектов
+func (s *cache[K, V]) SetMany(items map[K]V) {
+	keys := make([]K, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	for i, group := range s.groupKeys(keys) {
+		if len(group) == 0 {
+			continue
+		}
+		shard := s.shards[i]
+		shard.locker.Lock()
+		for _, key := range group {
+			shard.set(key, items[key])
+		}
+		shard.unlock()
+	}
+}
+
+// Удаление объектов по списку ключей. Возвращает количество удалённых объектов
+func (s *cache[K, V]) DeleteMany(keys []K) (res int) {
+	for i, group := range s.groupKeys(keys) {
+		if len(group) == 0 {
+			continue
+		}
+		shard := s.shards[i]
+		shard.locker.Lock()
+		for _, key := range group {
+			if shard.delete(key) {
+				s.stats.delete()
+				res++
+			}
+		}
+		shard.unlock()
+	}
+	return
+}
+
+// Поиск объектов по списку ключей с пакетной загрузкой отсутствующих. Метод loader вызывается однократно для всех
+// ненайденных ключей (например, для выполнения единственного SQL-запроса с условием IN) без блокировки хранилища,
+// загруженные объекты помещаются в хранилище. При ошибке загрузки возвращаются объекты, найденные в хранилище,
+// и ошибка loader. В отличие от Load, одновременные пакетные загрузки одних и тех же ключей не объединяются
+func (s *cache[K, V]) GetOrCreateMany(keys []K, cCall TypedCheckMethod[V], loader TypedBatchLoadMethod[K, V]) (map[K]V, error) {
+	if s.IsClosed() {
+		return nil, ErrClosed
+	}
+	res := s.GetMany(keys, cCall)
+	if len(res) == len(keys) {
+		return res, nil
+	}
+	missing, seen := make([]K, 0, len(keys)-len(res)), make(map[K]bool)
+	for _, key := range keys {
+		if _, check := res[key]; !check && !seen[key] {
+			seen[key] = true
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return res, nil
+	}
+	start := time.Now()
+	loaded, err := loader(missing)
+	s.stats.load(start, err == nil)
+	if err != nil {
+		return res, err
+	}
+	s.SetMany(loaded)
+	for _, key := range missing {
+		if val, check := loaded[key]; check {
+			res[key] = val
+		}
+	}
+	return res, nil
+}
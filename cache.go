@@ -1,206 +1,581 @@
 package containers
 
 import (
+	"errors"
+	"hash/maphash"
 	_ "log"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/fcg-xvii/containers/clock"
 )
 
+// Ошибка обращения к закрытому хранилищу
+var ErrClosed = errors.New("Cache is closed")
+
 // Шаблон метода инициализации объекта на стороне вызывающего объекта. Используется при необходимости иницилизировать объект, если он отсутствует в хрвнилище.
-type CreateMethod func(key interface{}) (interface{}, interface{}, bool)
+type CreateMethod = TypedCreateMethod[interface{}, interface{}]
+
+type CheckMethod = TypedCheckMethod[interface{}]
+
+// Типизированный вариант CreateMethod для TypedCache
+type TypedCreateMethod[K comparable, V any] func(key K) (K, V, bool)
+
+// Типизированный вариант CheckMethod для TypedCache
+type TypedCheckMethod[V any] func(val V) bool
 
-type CheckMethod func(val interface{}) bool
+// Вариант CreateMethod, дополнительно возвращающий стоимость созданного объекта (см. NewWeightedCache)
+type CreateCostMethod = TypedCreateCostMethod[interface{}, interface{}]
+
+// Типизированный вариант CreateCostMethod для TypedCache
+type TypedCreateCostMethod[K comparable, V any] func(key K) (K, V, int64, bool)
+
+// Вариант CreateMethod, дополнительно возвращающий время жизни созданного объекта (см. SetWithTTL)
+type CreateTTLMethod = TypedCreateTTLMethod[interface{}, interface{}]
+
+// Типизированный вариант CreateTTLMethod для TypedCache
+type TypedCreateTTLMethod[K comparable, V any] func(key K) (K, V, time.Duration, bool)
 
 // Структура для хранения элементов
-type cacheItem struct {
-	object interface{} // Исходный объект
-	expire int64       // Временная отметка, после наступления которой объект будет удалён клинером
+type cacheItem[V any] struct {
+	object   V              // Исходный объект
+	expire   int64          // Временная отметка, после наступления которой объект будет удалён клинером (0 - без ограничения)
+	ttl      time.Duration  // Время жизни объекта, на которое продлевается expire при обращении
+	mode     ExpirationMode // Режим истечения времени жизни
+	deadline int64          // Временная отметка, дальше которой expire не продлевается (0 - без ограничения)
+	cost     int64          // Стоимость (вес) объекта при ограничении суммарной стоимости хранилища
+	tags     []string       // Теги объекта (см. SetWithTags)
 }
 
-// Конструктор объекта кэша
+// Параметры хранилища, задаваемые при его создании
+type cacheConfig[K comparable, V any] struct {
+	interval, expired time.Duration                // Интервал активации клинера и время жизни объекта
+	mode              ExpirationMode               // Режим истечения времени жизни объектов по умолчанию
+	maxAge            time.Duration                // Максимальный возраст объекта в режиме EXPIRE_SLIDING_MAX_AGE
+	errorTTL          time.Duration                // Время кэширования ошибок загрузки (см. GetOrLoad)
+	clearPrepare      func([]V)                    // Пользовательский метод, в который передаются объекты перед удалением
+	onEvict           TypedEvictMethod[K, V]       // Пользовательский метод, вызываемый при удалении объекта (см. OnEvict)
+	capacity          int                          // Максимальное количество объектов в хранилище (0 - без ограничений)
+	maxCost           int64                        // Максимальная суммарная стоимость объектов (0 - без ограничений)
+	weigher           func(K, V) int64             // Метод расчёта стоимости объекта (при отсутствии стоимость объекта равна 1)
+	policy            PolicyConstructor[K]         // Конструктор политики вытеснения
+	shards            int                          // Количество сегментов хранилища
+	codec             Codec                        // Формат сохранения снимков хранилища (см. SaveTo)
+	clock             clock.Clock                  // Источник времени (по умолчанию системные часы)
+	loader            TypedContextLoadMethod[K, V] // Загрузчик по умолчанию (см. WithLoader)
+	noStats           bool                         // Флаг отключения сбора статистики
+	removeOnGet       bool                         // Удаление устаревших объектов при обращении к ним (см. SetRemoveExpiredOnGet)
+	refreshAhead      time.Duration                // Окно фонового обновления объекта до истечения времени жизни (см. SetRefreshAhead)
+	staleGrace        time.Duration                // Период выдачи устаревших объектов (см. SetStaleWhileRevalidate)
+	indexer           func() keyIndex[K]           // Конструктор упорядоченного индекса ключей сегмента (см. PrefixCache)
+}
+
+// Конструктор объекта кэша. Конструкторы с позиционными параметрами (NewCache, NewLRUCache, NewPolicyCache,
+// NewWeightedCache, NewShardedCache и их типизированные варианты) сохраняют прежнее поведение и не проверяют
+// сочетания параметров, проверка выполняется конструкторами New и NewTyped
 func NewCache(cleanInterval, itemExpired time.Duration, clearPrepare func([]interface{})) *Cache {
-	cache := &Cache{&cache{
-		locker:   new(sync.RWMutex),
-		items:    make(map[interface{}]*cacheItem),
+	return NewLRUCache(cleanInterval, itemExpired, 0, clearPrepare)
+}
+
+// Конструктор объекта кэша с ограниченной вместимостью. При превышении capacity из хранилища
+// вытесняются объекты, к которым дольше всего не было обращений (LRU). Вытесненные объекты передаются в clearPrepare.
+// Значение capacity <= 0 снимает ограничение
+func NewLRUCache(cleanInterval, itemExpired time.Duration, capacity int, clearPrepare func([]interface{})) *Cache {
+	return NewPolicyCache(cleanInterval, itemExpired, capacity, NewLRUPolicy[interface{}], clearPrepare)
+}
+
+// Конструктор объекта кэша с ограниченной вместимостью и заданной политикой вытеснения
+// (NewLRUPolicy, NewLFUPolicy, NewFIFOPolicy, NewARCPolicy, New2QPolicy или пользовательская реализация EvictionPolicy).
+// При policy == nil используется LRU
+func NewPolicyCache(cleanInterval, itemExpired time.Duration, capacity int, policy PolicyConstructor[interface{}], clearPrepare func([]interface{})) *Cache {
+	return newCacheWrapper(cacheConfig[interface{}, interface{}]{
+		interval: cleanInterval, expired: itemExpired,
+		capacity: capacity, policy: policy, clearPrepare: clearPrepare,
+	})
+}
+
+// Конструктор объекта кэша, ограниченного суммарной стоимостью объектов maxCost. Стоимость объекта задаётся
+// явно (SetWithCost, GetOrCreateWithCost) или рассчитывается методом weigher (например, как размер объекта в байтах).
+// При отсутствии weigher стоимость объекта, помещённого методом Set, равна 1. При превышении maxCost объекты
+// вытесняются согласно политике policy (при policy == nil используется LRU) до тех пор, пока суммарная стоимость не
+// уложится в ограничение. Вытесненные объекты передаются в clearPrepare
+func NewWeightedCache(cleanInterval, itemExpired time.Duration, maxCost int64, weigher func(key, value interface{}) int64, policy PolicyConstructor[interface{}], clearPrepare func([]interface{})) *Cache {
+	return newCacheWrapper(cacheConfig[interface{}, interface{}]{
 		interval: cleanInterval, expired: itemExpired,
-		stopCleanerChan: make(chan bool),
-		clearPrepare:    clearPrepare,
-	}}
+		maxCost: maxCost, weigher: weigher, policy: policy, clearPrepare: clearPrepare,
+	})
+}
+
+// Конструктор сегментированного объекта кэша. Объекты распределяются между shards сегментами по хэшу ключа,
+// каждый сегмент имеет собственную блокировку и собственный клинер, что снижает конкуренцию горутин за блокировку
+// при большом количестве ядер. Набор методов совпадает с обычным кэшем, clearPrepare вызывается каждым сегментом отдельно
+func NewShardedCache(shards int, cleanInterval, itemExpired time.Duration, clearPrepare func([]interface{})) *Cache {
+	return newCacheWrapper(cacheConfig[interface{}, interface{}]{
+		interval: cleanInterval, expired: itemExpired,
+		clearPrepare: clearPrepare, shards: shards,
+	})
+}
+
+func newCacheWrapper(config cacheConfig[interface{}, interface{}]) *Cache {
+	cache := &Cache{newCache(config)}
 	runtime.SetFinalizer(cache, destroyCache)
 	return cache
 }
 
+// Конструктор типизированного объекта кэша. Поведение полностью повторяет Cache, но ключи и значения
+// имеют заданные типы, поэтому приведение результатов Get и GetOrCreate не требуется
+func NewTypedCache[K comparable, V any](cleanInterval, itemExpired time.Duration, clearPrepare func([]V)) *TypedCache[K, V] {
+	return NewTypedLRUCache[K, V](cleanInterval, itemExpired, 0, clearPrepare)
+}
+
+// Конструктор типизированного объекта кэша с ограниченной вместимостью (аналогичен NewLRUCache)
+func NewTypedLRUCache[K comparable, V any](cleanInterval, itemExpired time.Duration, capacity int, clearPrepare func([]V)) *TypedCache[K, V] {
+	return NewTypedPolicyCache[K, V](cleanInterval, itemExpired, capacity, NewLRUPolicy[K], clearPrepare)
+}
+
+// Конструктор типизированного объекта кэша с заданной политикой вытеснения (аналогичен NewPolicyCache)
+func NewTypedPolicyCache[K comparable, V any](cleanInterval, itemExpired time.Duration, capacity int, policy PolicyConstructor[K], clearPrepare func([]V)) *TypedCache[K, V] {
+	return newTypedCacheWrapper(cacheConfig[K, V]{
+		interval: cleanInterval, expired: itemExpired,
+		capacity: capacity, policy: policy, clearPrepare: clearPrepare,
+	})
+}
+
+// Конструктор типизированного объекта кэша, ограниченного суммарной стоимостью объектов (аналогичен NewWeightedCache)
+func NewTypedWeightedCache[K comparable, V any](cleanInterval, itemExpired time.Duration, maxCost int64, weigher func(K, V) int64, policy PolicyConstructor[K], clearPrepare func([]V)) *TypedCache[K, V] {
+	return newTypedCacheWrapper(cacheConfig[K, V]{
+		interval: cleanInterval, expired: itemExpired,
+		maxCost: maxCost, weigher: weigher, policy: policy, clearPrepare: clearPrepare,
+	})
+}
+
+// Конструктор сегментированного типизированного объекта кэша (аналогичен NewShardedCache)
+func NewTypedShardedCache[K comparable, V any](shards int, cleanInterval, itemExpired time.Duration, clearPrepare func([]V)) *TypedCache[K, V] {
+	return newTypedCacheWrapper(cacheConfig[K, V]{
+		interval: cleanInterval, expired: itemExpired,
+		clearPrepare: clearPrepare, shards: shards,
+	})
+}
+
+func newTypedCacheWrapper[K comparable, V any](config cacheConfig[K, V]) *TypedCache[K, V] {
+	cache := &TypedCache[K, V]{newCache(config)}
+	runtime.SetFinalizer(cache, destroyTypedCache[K, V])
+	return cache
+}
+
+func newCache[K comparable, V any](config cacheConfig[K, V]) *cache[K, V] {
+	res := &cache[K, V]{
+		cacheConfig: &config,
+		seed:        maphash.MakeSeed(),
+	}
+	if !config.noStats {
+		res.stats = new(cacheStats)
+	}
+	if config.clock == nil {
+		config.clock = clock.System
+	}
+	if config.shards < 1 {
+		config.shards = 1
+	}
+	if (config.capacity > 0 || config.maxCost > 0) && config.policy == nil {
+		config.policy = NewLRUPolicy[K]
+	}
+	res.shards = make([]*cacheShard[K, V], config.shards)
+	for i := range res.shards {
+		// Ограничения вместимости и стоимости делятся между сегментами так, чтобы их сумма совпадала с заданной
+		shard := newCacheShard(res.cacheConfig, splitLimit(config.capacity, config.shards, i), splitLimit(config.maxCost, int64(config.shards), int64(i)))
+		shard.stats = res.stats
+		res.shards[i] = shard
+	}
+	return res
+}
+
+// Доля ограничения limit, приходящаяся на сегмент i из shards: остаток от деления распределяется по одной единице
+// между первыми сегментами
+func splitLimit[T int | int64](limit, shards, i T) T {
+	if i < limit%shards {
+		return limit/shards + 1
+	}
+	return limit / shards
+}
+
 // Обёртка для рабочей структуры (когда будет удалена ссылка объект, при сборке мусора
 // будет вызвана функция финализера (деструктора), которая остановит горутину клинера, если она запущена)
 type Cache struct {
-	*cache
+	*cache[interface{}, interface{}]
+}
+
+// Типизированная обёртка для рабочей структуры (аналогична Cache)
+type TypedCache[K comparable, V any] struct {
+	*cache[K, V]
+}
+
+// Рабочая структура. Объекты хранятся в сегментах (при создании без указания количества сегментов - в единственном)
+type cache[K comparable, V any] struct {
+	*cacheConfig[K, V]
+	shards    []*cacheShard[K, V] // Сегменты хранилища
+	seed      maphash.Seed        // Затравка хэша для выбора сегмента по ключу
+	loads     loadGroup[K, V]     // Выполняемые в данный момент загрузки объектов (см. Load)
+	refreshes loadGroup[K, V]     // Выполняемые в данный момент фоновые обновления объектов (см. SetRefreshAhead)
+	stats     *cacheStats         // Счётчики статистики работы хранилища
+	snapshots *snapshotTask       // Периодическое сохранение снимков (см. StartSnapshots)
+	closeOnce sync.Once           // Гарантирует однократное закрытие хранилища
+	closed    int32               // Флаг закрытого хранилища
 }
 
-// Рабочая структура
-type cache struct {
-	locker            *sync.RWMutex              // Мьютекс для работы с картой объектов
-	items             map[interface{}]*cacheItem // Карта объектов
-	interval, expired time.Duration              // Интервал активации клинера и время жизни объекта
-	stopCleanerChan   chan bool                  // Канал для остановки клинера (закрывается в деструкторе)
-	cleanerWork       bool                       // Флаг, указывающий на активность клинера
-	clearPrepare      func([]interface{})        // Пользовательский метод, в который передаются объекты перед удалением
+// Выбор сегмента, в котором хранится объект с ключом key
+func (s *cache[K, V]) shard(key K) *cacheShard[K, V] {
+	return s.shards[s.shardIndex(key)]
 }
 
-func (s *cache) Keys() []interface{} {
-	s.locker.RLock()
-	res := make([]interface{}, 0, len(s.items))
-	for key, _ := range s.items {
-		res = append(res, key)
+// Номер сегмента, в котором хранится объект с ключом key
+func (s *cache[K, V]) shardIndex(key K) int {
+	if len(s.shards) == 1 {
+		return 0
 	}
-	s.locker.RUnlock()
-	return res
+	return int(maphash.Comparable(s.seed, key) % uint64(len(s.shards)))
 }
 
-func (s *cache) set(key, value interface{}) {
-	s.items[key] = &cacheItem{value, time.Now().Add(s.expired).UnixNano()}
-	if !s.cleanerWork && s.expired > 0 {
-		s.cleanerWork = true
-		go s.runCleaner()
+// Блокировка на запись всех сегментов хранилища
+func (s *cache[K, V]) lockAll() {
+	for _, shard := range s.shards {
+		shard.locker.Lock()
 	}
 }
 
-func (s *cache) get(key interface{}, cCall CheckMethod) (res interface{}, check bool) {
-	var item *cacheItem
-	if item, check = s.items[key]; check {
-		if cCall != nil && !cCall(item.object) {
-			check = false
-			return
-		}
-		res = item.object
-		if time.Now().Add(s.expired).UnixNano() > atomic.LoadInt64(&item.expire) {
-			atomic.AddInt64(&item.expire, int64(s.expired))
+// Снятие блокировки со всех сегментов хранилища
+func (s *cache[K, V]) unlockAll() {
+	for _, shard := range s.shards {
+		shard.unlock()
+	}
+}
+
+func (s *cache[K, V]) Keys() []K {
+	res := make([]K, 0, s.Len())
+	for _, shard := range s.shards {
+		shard.locker.RLock()
+		for key, _ := range shard.items {
+			res = append(res, key)
 		}
+		shard.locker.RUnlock()
 	}
-	return
+	return res
 }
 
-func (s *cache) LockedSet(key, value interface{}) { s.set(key, value) }
-func (s *cache) LockedGet(key interface{}, cCall CheckMethod) (res interface{}, check bool) {
-	return s.get(key, cCall)
+func (s *cache[K, V]) LockedSet(key K, value V) { s.shard(key).set(key, value) }
+func (s *cache[K, V]) LockedGet(key K, cCall TypedCheckMethod[V]) (res V, check bool) {
+	shard := s.shard(key)
+	var state itemState
+	if res, check, state = shard.get(key, cCall); state == itemExpired && shard.removeOnGet && shard.expire(key, shard.clock.Now().UnixNano()) {
+		s.stats.expire(1)
+	}
+	s.stats.lookup(check)
+	return
 }
 
-func (s *cache) LockedOperation(method func()) {
-	s.locker.Lock()
+func (s *cache[K, V]) LockedOperation(method func()) {
+	s.lockAll()
 	method()
-	s.locker.Unlock()
+	s.unlockAll()
 }
 
 // Установка объекта по ключу
-func (s *cache) Set(key, value interface{}) {
-	s.locker.Lock()
-	s.set(key, value)
-	s.locker.Unlock()
+func (s *cache[K, V]) Set(key K, value V) {
+	shard := s.shard(key)
+	shard.locker.Lock()
+	shard.set(key, value)
+	shard.unlock()
+}
+
+// Установка объекта по ключу с явным указанием его стоимости
+func (s *cache[K, V]) SetWithCost(key K, value V, cost int64) {
+	shard := s.shard(key)
+	shard.locker.Lock()
+	shard.setItem(key, value, cost, shard.expiration(s.expired))
+	shard.unlock()
+}
+
+// Установка объекта по ключу с собственным временем жизни, заменяющим заданное в конструкторе.
+// Значение ttl <= 0 означает, что объект не будет удалён клинером
+func (s *cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	shard := s.shard(key)
+	shard.locker.Lock()
+	shard.setItem(key, value, shard.itemCost(key, value), shard.expiration(ttl))
+	shard.unlock()
 }
 
-// Поиск объекта по ключу. Если объект найден, увелививается его "время жизни"
-func (s *cache) Get(key interface{}, cCall CheckMethod) (res interface{}, check bool) {
-	s.locker.RLock()
-	res, check = s.get(key, cCall)
-	s.locker.RUnlock()
+// Установка объекта по ключу с собственными параметрами истечения времени жизни
+func (s *cache[K, V]) SetWithExpiration(key K, value V, exp Expiration) {
+	shard := s.shard(key)
+	shard.locker.Lock()
+	shard.setItem(key, value, shard.itemCost(key, value), exp)
+	shard.unlock()
+}
+
+// Установка режима истечения времени жизни для объектов, помещаемых в хранилище (по умолчанию EXPIRE_SLIDING).
+// Параметр maxAge используется только в режиме EXPIRE_SLIDING_MAX_AGE
+func (s *cache[K, V]) SetExpirationMode(mode ExpirationMode, maxAge time.Duration) {
+	s.lockAll()
+	s.mode, s.maxAge = mode, maxAge
+	s.unlockAll()
+}
+
+// Установка источника времени хранилища (например, тестовых часов из пакета clock/clocktest).
+// Уже запущенные клинеры продолжают использовать прежний источник, поэтому метод следует вызывать до помещения
+// объектов в хранилище
+func (s *cache[K, V]) SetClock(c clock.Clock) {
+	s.lockAll()
+	s.clock = c
+	s.unlockAll()
+}
+
+// Возвращает источник времени хранилища
+func (s *cache[K, V]) Clock() clock.Clock {
+	// Значение изменяется при блокировке всех сегментов, поэтому для чтения достаточно блокировки одного из них
+	s.shards[0].locker.RLock()
+	res := s.clock
+	s.shards[0].locker.RUnlock()
+	return res
+}
+
+// Поиск объекта по ключу. Если объект найден, увелививается его "время жизни".
+// Обновление объекта, требующего его (см. SetRefreshAhead), выполняется загрузчиком по умолчанию (см. WithLoader)
+func (s *cache[K, V]) Get(key K, cCall TypedCheckMethod[V]) (res V, check bool) {
+	return s.get(key, cCall, s.defaultLoader(), nil)
+}
+
+// Поиск объекта по ключу с учётом в статистике. Для объекта, требующего обновления, запускается фоновая
+// загрузка методом load (при его наличии), результат которой помещается в хранилище методом store (см. refresh)
+func (s *cache[K, V]) get(key K, cCall TypedCheckMethod[V], load TypedLoadMethod[K, V], store func(*cacheShard[K, V], K, V)) (res V, check bool) {
+	var state itemState
+	res, check, state = s.lookup(key, cCall)
+	s.stats.lookup(check)
+	if state == itemRefresh && load != nil {
+		s.refresh(key, load, store)
+	}
+	return
+}
+
+// Поиск объекта по ключу без учёта в статистике (для повторных проверок внутри методов хранилища)
+func (s *cache[K, V]) lookup(key K, cCall TypedCheckMethod[V]) (res V, check bool, state itemState) {
+	shard := s.shard(key)
+	shard.locker.RLock()
+	res, check, state = shard.get(key, cCall)
+	remove := state == itemExpired && shard.removeOnGet
+	shard.locker.RUnlock()
+	if remove {
+		// Пока блокировка снималась, объект мог быть заменён, поэтому истечение времени жизни проверяется повторно
+		shard.locker.Lock()
+		if shard.expire(key, shard.clock.Now().UnixNano()) {
+			s.stats.expire(1)
+		}
+		shard.unlock()
+	}
 	return
 }
 
+// Установка режима обращения к объектам, время жизни которых истекло, но которые ещё не удалены клинером.
+// Такие объекты в любом случае не выдаются методами поиска, а при enabled == true дополнительно удаляются
+// из хранилища с вызовом метода OnEvict (причина EVICT_EXPIRED). Интервал клинера при этом определяет только
+// скорость освобождения памяти от объектов, к которым нет обращений
+func (s *cache[K, V]) SetRemoveExpiredOnGet(enabled bool) {
+	s.lockAll()
+	s.removeOnGet = enabled
+	s.unlockAll()
+}
+
 // Метод, реализующий инициализацию нового объекта при отсутствии его в хранилище.
 // Если найти объект в хранилище не удалось, будет вызвана callback-функция createCall, в которой
 // необходимо создать объект для хранения и вернуть его (или false вторым аргументом, если инициализация объекта невозможна)
 // Внимание! В момент вызова createCall хранилище заблокировано для других горутин, поэтому
 // рекомендуется выполнять в createCall минимум операций, чтобы как можно скорее вернуть управление объекту хранилища!
-func (s *cache) GetOrCreate(key interface{}, cCall CheckMethod, createCall CreateMethod) (res interface{}, check bool) {
-	if res, check = s.Get(key, cCall); !check {
-		s.locker.Lock()
-		if res, check = s.get(key, cCall); check {
-			s.locker.Unlock()
+func (s *cache[K, V]) GetOrCreate(key K, cCall TypedCheckMethod[V], createCall TypedCreateMethod[K, V]) (res V, check bool) {
+	return s.getOrCreate(key, cCall, createCall, func(shard *cacheShard[K, V], key K, val V) {
+		shard.set(key, val)
+	})
+}
+
+// Аналог GetOrCreate, в котором createCall дополнительно возвращает стоимость созданного объекта
+func (s *cache[K, V]) GetOrCreateWithCost(key K, cCall TypedCheckMethod[V], createCall TypedCreateCostMethod[K, V]) (res V, check bool) {
+	var cost int64
+	return s.getOrCreate(key, cCall, func(key K) (rKey K, rVal V, rCheck bool) {
+		rKey, rVal, cost, rCheck = createCall(key)
+		return
+	}, func(shard *cacheShard[K, V], key K, val V) {
+		shard.setItem(key, val, cost, shard.expiration(s.expired))
+	})
+}
+
+// Аналог GetOrCreate, в котором createCall дополнительно возвращает время жизни созданного объекта
+// (например, срок действия токена, полученный от внешнего сервиса)
+func (s *cache[K, V]) GetOrCreateWithTTL(key K, cCall TypedCheckMethod[V], createCall TypedCreateTTLMethod[K, V]) (res V, check bool) {
+	var ttl time.Duration
+	return s.getOrCreate(key, cCall, func(key K) (rKey K, rVal V, rCheck bool) {
+		rKey, rVal, ttl, rCheck = createCall(key)
+		return
+	}, func(shard *cacheShard[K, V], key K, val V) {
+		shard.setItem(key, val, shard.itemCost(key, val), shard.expiration(ttl))
+	})
+}
+
+// Общая реализация GetOrCreate*. Созданный объект помещается в хранилище методом store при заблокированном сегменте.
+// Если createCall вернул ключ, относящийся к другому сегменту, объект помещается в него после снятия блокировки текущего
+func (s *cache[K, V]) getOrCreate(key K, cCall TypedCheckMethod[V], createCall TypedCreateMethod[K, V], store func(*cacheShard[K, V], K, V)) (res V, check bool) {
+	if s.IsClosed() {
+		return
+	}
+	if res, check = s.get(key, cCall, createLoader(createCall), store); !check {
+		shard := s.shard(key)
+		shard.locker.Lock()
+		var state itemState
+		if res, check, state = shard.get(key, cCall); check {
+			shard.unlock()
 			return
+		} else if state == itemExpired && shard.removeOnGet && shard.expire(key, shard.clock.Now().UnixNano()) {
+			s.stats.expire(1)
 		}
 
-		if key, res, check = createCall(key); check {
-			s.set(key, res)
+		start := time.Now()
+		key, res, check = createCall(key)
+		s.stats.load(start, check)
+		if check {
+			if target := s.shard(key); target != shard {
+				shard.unlock()
+				target.locker.Lock()
+				store(target, key, res)
+				target.unlock()
+				return
+			}
+			store(shard, key, res)
 		}
-		s.locker.Unlock()
+		shard.unlock()
 	}
 	return
 }
 
-func (s *cache) Each(key interface{}, checkCall CheckMethod, createCall CreateMethod) (res interface{}, check bool) {
-	s.locker.Lock()
-	for _, v := range s.items {
-		if checkCall(v.object) {
-			s.locker.Unlock()
-			return v.object, true
+func (s *cache[K, V]) Each(key K, checkCall TypedCheckMethod[V], createCall TypedCreateMethod[K, V]) (res V, check bool) {
+	s.lockAll()
+	for _, shard := range s.shards {
+		now := shard.clock.Now().UnixNano()
+		for key, v := range shard.items {
+			if shard.itemState(v, now) == itemExpired {
+				// Объекты, время жизни которых истекло, не выдаются (см. SetRemoveExpiredOnGet)
+				if shard.removeOnGet && shard.expire(key, now) {
+					s.stats.expire(1)
+				}
+				continue
+			}
+			if checkCall(v.object) {
+				s.unlockAll()
+				return v.object, true
+			}
 		}
 	}
 	if createCall != nil {
 		if key, res, check = createCall(key); check {
-			s.set(key, res)
+			s.shard(key).set(key, res)
 		}
 	}
-	s.locker.Unlock()
+	s.unlockAll()
 	return
 }
 
-// Запуск клинера (запускается при непустой карте объектов и останавливается при пустой)
-func (s *cache) runCleaner() {
-	ticker := time.NewTicker(s.interval)
-	for {
-		select {
-		case <-ticker.C: // По сигналу тикера начинаем удаление устаревших объектов
-			now := time.Now().UnixNano()
-			var removedItems []interface{}
-			s.locker.Lock()
-			for key, v := range s.items {
-				if now > v.expire {
-					removedItems = append(removedItems, v.object)
-					delete(s.items, key)
-				}
-			}
-			// Если карта объектов пуста, завершаем работу клинерв
-			if len(s.items) == 0 {
-				s.cleanerWork = false
-				ticker.Stop()
-				s.locker.Unlock()
-				if s.clearPrepare != nil && len(removedItems) > 0 {
-					s.clearPrepare(removedItems)
-				}
-				return
-			}
-			s.locker.Unlock()
-			if s.clearPrepare != nil && len(removedItems) > 0 {
-				s.clearPrepare(removedItems)
-			}
-		case <-s.stopCleanerChan: // Деструктор, запущеный сборщиком мусора, закрывает канал, завершаем работу клинера
-			s.cleanerWork = false
-			ticker.Stop()
-			return
-		}
-	}
-}
-
 // Возвращает количество элементов в хранилище хэша
-func (s *cache) Len() int {
-	s.locker.RLock()
-	res := len(s.items)
-	s.locker.RUnlock()
-	return res
+func (s *cache[K, V]) Len() (res int) {
+	for _, shard := range s.shards {
+		shard.locker.RLock()
+		res += len(shard.items)
+		shard.locker.RUnlock()
+	}
+	return
 }
 
-func (s *cache) delete(key interface{}) {
-	delete(s.items, key)
+// Возвращает суммарную стоимость объектов в хранилище
+func (s *cache[K, V]) Cost() (res int64) {
+	for _, shard := range s.shards {
+		shard.locker.RLock()
+		res += shard.cost
+		shard.locker.RUnlock()
+	}
+	return
 }
 
-func (s *cache) Delete(key interface{}) {
-	s.locker.Lock()
-	s.delete(key)
-	s.locker.Unlock()
+func (s *cache[K, V]) Delete(key K) {
+	shard := s.shard(key)
+	shard.locker.Lock()
+	if shard.delete(key) {
+		s.stats.delete()
+	}
+	shard.unlock()
 }
 
 // Деструктор, вызываемый сборщиком мусора
 func destroyCache(cache *Cache) {
-	close(cache.stopCleanerChan) // Канал передаст сигнал о своём закрытии клинеру, который закроется, если он запущен
+	cache.destroy()
+}
+
+// Деструктор типизированного кэша, вызываемый сборщиком мусора
+func destroyTypedCache[K comparable, V any](cache *TypedCache[K, V]) {
+	cache.destroy()
+}
+
+func (s *cache[K, V]) destroy() {
+	s.close(false)
+}
+
+// Закрытие хранилища: останавливает клинеры (метод дожидается их завершения, кроме клинера, из метода OnEvict
+// которого он вызван) и периодическое сохранение снимков.
+// После закрытия объекты не помещаются в хранилище и не выдаются из него, методы загрузки возвращают ErrClosed.
+// Повторный вызов возвращает ErrClosed. Если хранилище не было закрыто явно, оно закрывается деструктором,
+// вызываемым сборщиком мусора
+func (s *cache[K, V]) Close() error {
+	return s.close(false)
+}
+
+// Закрытие хранилища (аналогично Close) с удалением всех объектов. Удалённые объекты передаются
+// в метод, установленный OnEvict, с причиной EVICT_CLOSED
+func (s *cache[K, V]) CloseAndFlush() error {
+	return s.close(true)
+}
+
+// Проверка закрытия хранилища
+func (s *cache[K, V]) IsClosed() bool {
+	return atomic.LoadInt32(&s.closed) == 1
+}
+
+func (s *cache[K, V]) close(flush bool) (err error) {
+	err = ErrClosed
+	s.closeOnce.Do(func() {
+		err = nil
+		atomic.StoreInt32(&s.closed, 1)
+		s.StopSnapshots()
+		var cleaners []chan bool
+		var self int64 // Горутина, из которой вызван Close (вычисляется, только если клинер оповещает об объектах)
+		s.lockAll()
+		for _, shard := range s.shards {
+			shard.closed = true
+			if shard.cleanerNotifier != 0 && self == 0 {
+				self = goroutineID()
+			}
+			// Ожидается в том числе завершающийся клинер, который ещё оповещает об удалённых объектах,
+			// кроме клинера, из метода OnEvict которого вызван Close
+			if shard.cleanerDone != nil && (shard.cleanerNotifier == 0 || shard.cleanerNotifier != self) {
+				cleaners = append(cleaners, shard.cleanerDone)
+			}
+			if flush {
+				for key, item := range shard.items {
+					shard.evicted = append(shard.evicted, evictedItem[K, V]{key, item.object, EVICT_CLOSED})
+				}
+				shard.reset()
+			}
+			close(shard.stopCleanerChan) // Канал передаст сигнал о своём закрытии клинеру, который закроется, если он запущен
+		}
+		s.unlockAll()
+		for _, done := range cleaners {
+			<-done
+		}
+	})
+	return
 }
@@ -0,0 +1,47 @@
+// Пакет clock определяет источник времени, используемый хранилищами и файловыми контейнерами пакета containers.
+// Подмена источника (например, тестовыми часами из пакета clocktest) позволяет проверять истечение времени жизни
+// объектов без реального ожидания
+package clock
+
+import "time"
+
+// Источник времени
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Тикер, аналогичный time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Тикер, получатель которого подтверждает завершение обработки каждого сигнала.
+// Используется тестовыми часами, чтобы дождаться окончания работы, запущенной сигналом тикера
+type AckTicker interface {
+	Ticker
+	Ack()
+}
+
+// Подтверждение обработки сигнала тикера (для тикеров, не поддерживающих подтверждение, ничего не делает)
+func Ack(t Ticker) {
+	if at, check := t.(AckTicker); check {
+		at.Ack()
+	}
+}
+
+// Системные часы
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (s systemTicker) C() <-chan time.Time { return s.Ticker.C }
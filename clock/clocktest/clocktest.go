@@ -0,0 +1,136 @@
+// Пакет clocktest реализует управляемые вручную часы для тестов
+package clocktest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fcg-xvii/containers/clock"
+)
+
+// Конструктор тестовых часов, показывающих время now
+func New(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Тестовые часы. Время изменяется только методом Advance
+type Clock struct {
+	locker  sync.Mutex
+	now     time.Time
+	tickers []*ticker
+}
+
+func (s *Clock) Now() time.Time {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.now
+}
+
+func (s *Clock) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("clocktest: non-positive interval for NewTicker")
+	}
+	s.locker.Lock()
+	t := &ticker{
+		clock: s, interval: d, next: s.now.Add(d),
+		c: make(chan time.Time), ack: make(chan bool), stopped: make(chan bool),
+	}
+	s.tickers = append(s.tickers, t)
+	s.locker.Unlock()
+	return t
+}
+
+// Перевод часов вперёд на d. Каждый тикер, срок срабатывания которого наступил, получает сигнал
+// (по одному на каждый прошедший интервал, в порядке наступления сроков). Метод дожидается получения сигнала
+// и подтверждения его обработки получателем (clock.Ack) либо остановки тикера, поэтому после возврата из Advance
+// вызванная сигналами работа (например, удаление устаревших объектов клинером) уже выполнена. Тикеры, созданные
+// во время работы Advance, также получают сигналы, если их срок наступает до нового времени часов.
+// Метод допускает одновременный вызов из нескольких горутин
+func (s *Clock) Advance(d time.Duration) {
+	s.locker.Lock()
+	s.now = s.now.Add(d)
+	s.locker.Unlock()
+	for {
+		t, next := s.due()
+		if t == nil {
+			return
+		}
+		t.fire(next)
+	}
+}
+
+// Выбор тикера с наиболее ранним наступившим сроком срабатывания. Срок тикера сдвигается на следующий интервал
+func (s *Clock) due() (res *ticker, next time.Time) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for _, t := range s.tickers {
+		if !t.next.After(s.now) && (res == nil || t.next.Before(res.next)) {
+			res = t
+		}
+	}
+	if res != nil {
+		next = res.next
+		res.next = res.next.Add(res.interval)
+	}
+	return
+}
+
+// Количество активных (не остановленных) тикеров
+func (s *Clock) Tickers() int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return len(s.tickers)
+}
+
+func (s *Clock) remove(t *ticker) {
+	s.locker.Lock()
+	for i, v := range s.tickers {
+		if v == t {
+			s.tickers = append(s.tickers[:i], s.tickers[i+1:]...)
+			break
+		}
+	}
+	s.locker.Unlock()
+}
+
+type ticker struct {
+	clock    *Clock
+	interval time.Duration
+	next     time.Time // Срок следующего срабатывания (изменяется под блокировкой часов)
+	c        chan time.Time
+	ack      chan bool
+	stopped  chan bool
+	stopOnce sync.Once
+}
+
+func (s *ticker) C() <-chan time.Time { return s.c }
+
+func (s *ticker) Stop() {
+	s.stopOnce.Do(func() {
+		// Тикер исключается из часов до закрытия канала, чтобы после возврата из Advance Tickers учитывал остановку
+		s.clock.remove(s)
+		close(s.stopped)
+	})
+}
+
+func (s *ticker) Ack() {
+	select {
+	case s.ack <- true:
+	case <-s.stopped:
+	}
+}
+
+// Отправка сигнала с ожиданием подтверждения его обработки. Возвращает false для остановленного тикера
+func (s *ticker) fire(now time.Time) bool {
+	select {
+	case s.c <- now:
+	case <-s.stopped:
+		return false
+	}
+	select {
+	case <-s.ack:
+		return true
+	case <-s.stopped:
+		return false
+	}
+}
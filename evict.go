@@ -0,0 +1,91 @@
+package containers
+
+// Причина удаления объекта из хранилища
+type EvictReason byte
+
+const (
+	EVICT_EXPIRED     EvictReason = iota // Истекло время жизни объекта (удалён клинером)
+	EVICT_DELETED                        // Объект удалён явно
+	EVICT_REPLACED                       // Объект заменён новым значением по тому же ключу
+	EVICT_CAPACITY                       // Объект вытеснен при превышении вместимости или стоимости
+	EVICT_CLEARED                        // Хранилище очищено методом Clear
+	EVICT_CLOSED                         // Хранилище закрыто методом CloseAndFlush
+	EVICT_INVALIDATED                    // Объект удалён вместе с другими объектами с тем же тегом (см. InvalidateTag)
+)
+
+func (s EvictReason) String() string {
+	switch s {
+	case EVICT_EXPIRED:
+		return "EVICT_EXPIRED"
+	case EVICT_DELETED:
+		return "EVICT_DELETED"
+	case EVICT_REPLACED:
+		return "EVICT_REPLACED"
+	case EVICT_CAPACITY:
+		return "EVICT_CAPACITY"
+	case EVICT_CLEARED:
+		return "EVICT_CLEARED"
+	case EVICT_CLOSED:
+		return "EVICT_CLOSED"
+	case EVICT_INVALIDATED:
+		return "EVICT_INVALIDATED"
+	default:
+		return "EVICT_UNDEFINED"
+	}
+}
+
+// Шаблон метода, вызываемого при удалении объекта из хранилища (см. OnEvict)
+type EvictMethod = TypedEvictMethod[interface{}, interface{}]
+
+// Типизированный вариант EvictMethod для TypedCache
+type TypedEvictMethod[K comparable, V any] func(key K, value V, reason EvictReason)
+
+// Удалённый объект, ожидающий оповещения после снятия блокировки сегмента
+type evictedItem[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// Оповещение об удалённых объектах. Метод OnEvict получает все удалённые объекты, clearPrepare
+// (для совместимости) - только удалённые клинером и вытесненные при превышении вместимости
+func notifyEvicted[K comparable, V any](evicted []evictedItem[K, V], onEvict TypedEvictMethod[K, V], clearPrepare func([]V)) {
+	if onEvict != nil {
+		for _, item := range evicted {
+			onEvict(item.key, item.value, item.reason)
+		}
+	}
+	if clearPrepare != nil {
+		var values []V
+		for _, item := range evicted {
+			if item.reason == EVICT_EXPIRED || item.reason == EVICT_CAPACITY {
+				values = append(values, item.value)
+			}
+		}
+		if len(values) > 0 {
+			clearPrepare(values)
+		}
+	}
+}
+
+// Установка метода, вызываемого при каждом удалении объекта из хранилища с указанием причины удаления
+// (истечение времени жизни, явное удаление, замена значения, вытеснение, очистка хранилища), что позволяет
+// освобождать ресурсы, удерживаемые объектами. Метод вызывается после снятия блокировки хранилища
+func (s *cache[K, V]) OnEvict(method TypedEvictMethod[K, V]) {
+	s.lockAll()
+	s.onEvict = method
+	s.unlockAll()
+}
+
+// Удаление всех объектов из хранилища
+func (s *cache[K, V]) Clear() {
+	s.lockAll()
+	for _, shard := range s.shards {
+		for key, item := range shard.items {
+			shard.policyRemove(key)
+			shard.evicted = append(shard.evicted, evictedItem[K, V]{key, item.object, EVICT_CLEARED})
+		}
+		shard.reset()
+	}
+	s.unlockAll()
+}
@@ -0,0 +1,156 @@
+package containers
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+)
+
+// Режим истечения времени жизни объекта хранилища
+type ExpirationMode byte
+
+const (
+	EXPIRE_SLIDING         ExpirationMode = iota // Время жизни продлевается при каждом обращении к объекту
+	EXPIRE_ABSOLUTE                              // Объект удаляется по истечении времени жизни с момента помещения в хранилище
+	EXPIRE_SLIDING_MAX_AGE                       // Время жизни продлевается при обращении, но не дальше максимального возраста объекта
+)
+
+func (s ExpirationMode) String() string {
+	switch s {
+	case EXPIRE_SLIDING:
+		return "EXPIRE_SLIDING"
+	case EXPIRE_ABSOLUTE:
+		return "EXPIRE_ABSOLUTE"
+	case EXPIRE_SLIDING_MAX_AGE:
+		return "EXPIRE_SLIDING_MAX_AGE"
+	default:
+		return "EXPIRE_UNDEFINED"
+	}
+}
+
+// Параметры истечения времени жизни объекта
+type Expiration struct {
+	TTL    time.Duration  // Время жизни (значение <= 0 - без ограничения)
+	Mode   ExpirationMode // Режим истечения времени жизни
+	MaxAge time.Duration  // Максимальный возраст объекта в режиме EXPIRE_SLIDING_MAX_AGE (значение <= 0 - без ограничения)
+}
+
+// Расчёт временных отметок истечения времени жизни и максимального возраста для объекта, помещаемого в хранилище
+func (s Expiration) deadlines(now time.Time) (expire, deadline int64) {
+	if s.TTL > 0 {
+		expire = now.Add(s.TTL).UnixNano()
+	}
+	if s.Mode == EXPIRE_SLIDING_MAX_AGE && s.MaxAge > 0 {
+		deadline = now.Add(s.MaxAge).UnixNano()
+		if expire == 0 || expire > deadline {
+			expire = deadline
+		}
+	}
+	return
+}
+
+// Проверка истечения времени жизни объекта к моменту now
+func (s *cacheItem[V]) expired(now int64) bool {
+	expire := atomic.LoadInt64(&s.expire)
+	return expire > 0 && now > expire
+}
+
+// Продление времени жизни объекта при обращении к нему (в режиме EXPIRE_ABSOLUTE время жизни не продлевается)
+func (s *cacheItem[V]) touch(now time.Time) {
+	if s.ttl <= 0 || s.mode == EXPIRE_ABSOLUTE {
+		return
+	}
+	for {
+		expire := atomic.LoadInt64(&s.expire)
+		if now.Add(s.ttl).UnixNano() <= expire {
+			return
+		}
+		next := expire + int64(s.ttl)
+		if s.deadline > 0 && next > s.deadline {
+			next = s.deadline
+		}
+		if next <= expire || atomic.CompareAndSwapInt64(&s.expire, expire, next) {
+			return
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////
+
+// Очередь истечения времени жизни объектов сегмента. Клинер извлекает из неё только ключи, срок которых наступил,
+// вместо обхода всей карты объектов. Продление времени жизни при обращении (touch) очередь не изменяет: отметка
+// записи может отставать от отметки объекта и уточняется при извлечении записи
+type expiryQueue[K comparable] struct {
+	entries expiryHeap[K]
+	index   map[K]*expiryEntry[K]
+}
+
+type expiryEntry[K comparable] struct {
+	key    K
+	expire int64 // Временная отметка истечения времени жизни на момент постановки в очередь
+	index  int   // Позиция в куче
+}
+
+func newExpiryQueue[K comparable]() *expiryQueue[K] {
+	return &expiryQueue[K]{index: make(map[K]*expiryEntry[K])}
+}
+
+func (s *expiryQueue[K]) Len() int { return len(s.entries) }
+
+// Постановка ключа в очередь с отметкой expire (0 - удаление ключа из очереди)
+func (s *expiryQueue[K]) set(key K, expire int64) {
+	entry, check := s.index[key]
+	switch {
+	case expire == 0:
+		s.remove(key)
+	case check:
+		entry.expire = expire
+		heap.Fix(&s.entries, entry.index)
+	default:
+		entry = &expiryEntry[K]{key: key, expire: expire}
+		s.index[key] = entry
+		heap.Push(&s.entries, entry)
+	}
+}
+
+func (s *expiryQueue[K]) remove(key K) {
+	if entry, check := s.index[key]; check {
+		heap.Remove(&s.entries, entry.index)
+		delete(s.index, key)
+	}
+}
+
+// Извлечение ключа с наименьшей отметкой, если она не превышает now
+func (s *expiryQueue[K]) popDue(now int64) (key K, check bool) {
+	if len(s.entries) > 0 && s.entries[0].expire < now {
+		entry := heap.Pop(&s.entries).(*expiryEntry[K])
+		delete(s.index, entry.key)
+		key, check = entry.key, true
+	}
+	return
+}
+
+// Куча записей очереди истечения (на вершине - запись с наименьшей отметкой)
+type expiryHeap[K comparable] []*expiryEntry[K]
+
+func (s expiryHeap[K]) Len() int           { return len(s) }
+func (s expiryHeap[K]) Less(i, j int) bool { return s[i].expire < s[j].expire }
+
+func (s expiryHeap[K]) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+	s[i].index, s[j].index = i, j
+}
+
+func (s *expiryHeap[K]) Push(x interface{}) {
+	entry := x.(*expiryEntry[K])
+	entry.index = len(*s)
+	*s = append(*s, entry)
+}
+
+func (s *expiryHeap[K]) Pop() interface{} {
+	old := *s
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*s = old[:len(old)-1]
+	return entry
+}
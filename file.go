@@ -5,6 +5,9 @@ import (
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/fcg-xvii/containers/clock"
 )
 
 type FileIndexCallback func([]byte, func(interface{})) error
@@ -13,14 +16,27 @@ type FileMapCallback func([]byte, func(interface{}, interface{})) error
 type file struct {
 	path                string
 	modified            int64
+	reloads             int64 // Количество успешных перечитываний файла
+	parseErrors         int64 // Количество ошибок доступа к файлу, его чтения и разбора
+	checked             int64 // Временная отметка последней проверки времени изменения файла
+	checkInterval       int64 // Минимальный интервал между проверками времени изменения файла (0 - проверка при каждом обращении)
+	clock               clock.Clock
 	locker              *sync.RWMutex
 	parseMethod         func([]byte) error
 	updatePrepareMethod func()
 }
 
 func (s *file) update() error {
+	if interval := atomic.LoadInt64(&s.checkInterval); interval > 0 && atomic.LoadInt64(&s.modified) != 0 {
+		// Файл уже загружен, время изменения проверяется не чаще заданного интервала
+		now := s.now().UnixNano()
+		if checked := atomic.LoadInt64(&s.checked); now-checked < interval || !atomic.CompareAndSwapInt64(&s.checked, checked, now) {
+			return nil
+		}
+	}
 	info, err := os.Stat(s.path)
 	if err != nil {
+		atomic.AddInt64(&s.parseErrors, 1)
 		return err
 	}
 	if atomic.LoadInt64(&s.modified) != info.ModTime().UnixNano() {
@@ -35,19 +51,62 @@ func (s *file) update() error {
 		var src []byte
 		if src, err = ioutil.ReadFile(s.path); err == nil {
 			if err = s.parseMethod(src); err == nil {
+				atomic.StoreInt64(&s.checked, s.source().Now().UnixNano())
 				atomic.StoreInt64(&s.modified, info.ModTime().UnixNano())
+				atomic.AddInt64(&s.reloads, 1)
 			}
 		}
+		if err != nil {
+			atomic.AddInt64(&s.parseErrors, 1)
+		}
 		s.locker.Unlock()
 		return err
 	}
 	return nil
 }
 
+// Источник времени контейнера (вызывается под блокировкой)
+func (s *file) source() clock.Clock {
+	if s.clock == nil {
+		return clock.System
+	}
+	return s.clock
+}
+
+func (s *file) now() time.Time {
+	s.locker.RLock()
+	res := s.source()
+	s.locker.RUnlock()
+	return res.Now()
+}
+
+// Установка источника времени, используемого для отсчёта интервала проверки изменения файла
+func (s *file) SetClock(c clock.Clock) {
+	s.locker.Lock()
+	s.clock = c
+	s.locker.Unlock()
+}
+
+// Установка минимального интервала между проверками времени изменения файла. По умолчанию (0) время изменения
+// проверяется при каждом обращении к контейнеру, что требует системного вызова
+func (s *file) SetCheckInterval(interval time.Duration) {
+	atomic.StoreInt64(&s.checkInterval, int64(interval))
+}
+
 func (s *file) ModifiedTimestamp() int64 {
 	return atomic.LoadInt64(&s.modified)
 }
 
+// Возвращает количество успешных перечитываний файла
+func (s *file) Reloads() int64 {
+	return atomic.LoadInt64(&s.reloads)
+}
+
+// Возвращает количество ошибок доступа к файлу, его чтения и разбора
+func (s *file) ParseErrors() int64 {
+	return atomic.LoadInt64(&s.parseErrors)
+}
+
 ////////////////////////////////////////////////////////////////////////////
 
 func NewFileObject(path string, parseCallback FileIndexCallback) *FileObject {
@@ -160,8 +219,7 @@ func (s *FileMap) append(key, val interface{}) {
 }
 
 func (s *FileMap) parse(src []byte) error {
-	s.parseCallback(src, s.append)
-	return nil
+	return s.parseCallback(src, s.append)
 }
 
 func (s *FileMap) Get(key interface{}) (interface{}, bool, error) {
@@ -0,0 +1,225 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Ошибка загрузки объекта без указания загрузчика для хранилища, созданного без загрузчика по умолчанию (см. WithLoader)
+var ErrNoLoader = errors.New("Cache loader is not defined")
+
+// Шаблон метода загрузки объекта, отсутствующего в хранилище. В отличие от CreateMethod, возвращает причину ошибки
+type LoadMethod = TypedLoadMethod[interface{}, interface{}]
+
+// Типизированный вариант LoadMethod для TypedCache
+type TypedLoadMethod[K comparable, V any] func(key K) (V, error)
+
+// Шаблон метода загрузки объекта с поддержкой контекста (см. GetOrLoad)
+type ContextLoadMethod = TypedContextLoadMethod[interface{}, interface{}]
+
+// Типизированный вариант ContextLoadMethod для TypedCache
+type TypedContextLoadMethod[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// Выполняемая в данный момент загрузка объекта. Горутины, запросившие тот же ключ,
+// ожидают закрытия канала done и получают общий результат
+type loadCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// Ошибка загрузки объекта, сохранённая для повторной выдачи без вызова загрузчика
+type loadFailure struct {
+	err    error
+	expire int64 // Временная отметка, после наступления которой ошибка перестаёт действовать
+}
+
+// Группа выполняемых загрузок объектов хранилища
+type loadGroup[K comparable, V any] struct {
+	locker   sync.Mutex
+	calls    map[K]*loadCall[V]
+	failures map[K]loadFailure // Закэшированные ошибки загрузки (см. SetErrorTTL)
+}
+
+// Регистрация загрузки объекта по ключу. Возвращает описание загрузки и флаг, указывающий,
+// что загрузку должна выполнить вызывающая горутина (в противном случае необходимо ожидать её завершения)
+func (s *loadGroup[K, V]) start(key K) (*loadCall[V], bool) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if call, check := s.calls[key]; check {
+		return call, false
+	}
+	if s.calls == nil {
+		s.calls = make(map[K]*loadCall[V])
+	}
+	call := &loadCall[V]{done: make(chan struct{})}
+	s.calls[key] = call
+	return call, true
+}
+
+// Завершение загрузки объекта и оповещение ожидающих горутин
+func (s *loadGroup[K, V]) finish(key K, call *loadCall[V]) {
+	s.locker.Lock()
+	delete(s.calls, key)
+	s.locker.Unlock()
+	close(call.done)
+}
+
+// Сохранение ошибки загрузки на время ttl. Одновременно удаляются ошибки, срок действия которых истёк
+func (s *loadGroup[K, V]) fail(key K, err error, ttl time.Duration, now int64) {
+	s.locker.Lock()
+	if s.failures == nil {
+		s.failures = make(map[K]loadFailure)
+	}
+	for fKey, f := range s.failures {
+		if now > f.expire {
+			delete(s.failures, fKey)
+		}
+	}
+	s.failures[key] = loadFailure{err, now + int64(ttl)}
+	s.locker.Unlock()
+}
+
+// Поиск действующей ошибки загрузки по ключу
+func (s *loadGroup[K, V]) failure(key K, now int64) (err error, check bool) {
+	s.locker.Lock()
+	var f loadFailure
+	if f, check = s.failures[key]; check {
+		if now > f.expire {
+			delete(s.failures, key)
+			check = false
+		} else {
+			err = f.err
+		}
+	}
+	s.locker.Unlock()
+	return
+}
+
+// Выполнение загрузки объекта горутиной, зарегистрировавшей её. Паника в методе загрузки
+// преобразуется в ошибку, чтобы ожидающие горутины не остались заблокированными
+func (s *loadGroup[K, V]) run(key K, call *loadCall[V], method func() (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("Cache loader panic :: %v", r)
+		}
+		s.finish(key, call)
+	}()
+	call.val, call.err = method()
+}
+
+// Загрузчик по умолчанию в формате LoadMethod (nil при его отсутствии)
+func (s *cache[K, V]) defaultLoader() TypedLoadMethod[K, V] {
+	if s.loader == nil {
+		return nil
+	}
+	return func(key K) (V, error) { return s.loader(context.Background(), key) }
+}
+
+// Поиск объекта по ключу с загрузкой при его отсутствии. В отличие от GetOrCreate, хранилище не блокируется
+// на время выполнения loader: остальные ключи доступны для чтения и записи, а горутины, одновременно запросившие
+// отсутствующий ключ, ожидают завершения единственной загрузки и получают её результат (в том числе ошибку).
+// Успешно загруженный объект помещается в хранилище, ошибка не кэшируется. При loader == nil используется
+// загрузчик по умолчанию (WithLoader), при его отсутствии возвращается ErrNoLoader
+func (s *cache[K, V]) Load(key K, cCall TypedCheckMethod[V], loader TypedLoadMethod[K, V]) (V, error) {
+	if loader == nil {
+		loader = s.defaultLoader()
+	}
+	if s.IsClosed() || loader == nil {
+		var empty V
+		if loader == nil {
+			return empty, ErrNoLoader
+		}
+		return empty, ErrClosed
+	}
+	if res, check := s.get(key, cCall, loader, nil); check {
+		return res, nil
+	}
+	call, leader := s.loads.start(key)
+	if leader {
+		s.loads.run(key, call, func() (V, error) {
+			// Пока регистрировалась загрузка, объект мог быть помещён в хранилище завершившейся загрузкой
+			if res, check, _ := s.lookup(key, cCall); check {
+				return res, nil
+			}
+			start := time.Now()
+			res, err := loader(key)
+			s.stats.load(start, err == nil)
+			if err == nil {
+				s.Set(key, res)
+			}
+			return res, err
+		})
+	} else {
+		<-call.done
+	}
+	return call.val, call.err
+}
+
+// Поиск объекта по ключу с загрузкой при его отсутствии. Загрузка выполняется так же, как в Load (единственный
+// вызов loader для одновременных запросов одного ключа без блокировки хранилища), но отдельной горутиной, поэтому
+// каждая ожидающая горутина может прервать ожидание отменой своего контекста ctx. Загрузчику передаётся контекст
+// инициировавшей загрузку горутины без возможности отмены. Если для хранилища задано время жизни ошибок (SetErrorTTL),
+// ошибка загрузки возвращается повторными вызовами без обращения к loader до истечения этого времени.
+// При loader == nil используется загрузчик по умолчанию (WithLoader), при его отсутствии возвращается ErrNoLoader
+func (s *cache[K, V]) GetOrLoad(ctx context.Context, key K, loader TypedContextLoadMethod[K, V]) (res V, err error) {
+	if s.IsClosed() {
+		return res, ErrClosed
+	}
+	if loader == nil {
+		if loader = s.loader; loader == nil {
+			return res, ErrNoLoader
+		}
+	}
+	var check bool
+	if res, check = s.get(key, nil, func(key K) (V, error) { return loader(context.WithoutCancel(ctx), key) }, nil); check {
+		return
+	}
+	if err, check = s.loads.failure(key, s.Clock().Now().UnixNano()); check {
+		return
+	}
+	call, leader := s.loads.start(key)
+	if leader {
+		loadCtx := context.WithoutCancel(ctx)
+		go s.loads.run(key, call, func() (V, error) {
+			if res, check, _ := s.lookup(key, nil); check {
+				return res, nil
+			}
+			start := time.Now()
+			res, err := loader(loadCtx, key)
+			s.stats.load(start, err == nil)
+			if err == nil {
+				s.Set(key, res)
+			} else if ttl := s.ErrorTTL(); ttl > 0 {
+				s.loads.fail(key, err, ttl, s.Clock().Now().UnixNano())
+			}
+			return res, err
+		})
+	}
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		return res, ctx.Err()
+	}
+}
+
+// Установка времени, в течение которого ошибка загрузки объекта методом GetOrLoad возвращается без повторного
+// обращения к загрузчику (значение <= 0 отключает кэширование ошибок)
+func (s *cache[K, V]) SetErrorTTL(ttl time.Duration) {
+	s.lockAll()
+	s.errorTTL = ttl
+	s.unlockAll()
+}
+
+// Возвращает время кэширования ошибок загрузки
+func (s *cache[K, V]) ErrorTTL() time.Duration {
+	// Значение изменяется при блокировке всех сегментов, поэтому для чтения достаточно блокировки одного из них
+	s.shards[0].locker.RLock()
+	res := s.errorTTL
+	s.shards[0].locker.RUnlock()
+	return res
+}
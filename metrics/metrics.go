@@ -0,0 +1,194 @@
+// Пакет metrics публикует показатели хранилищ и файловых контейнеров пакета containers
+// в виде переменных expvar и в текстовом формате Prometheus (без внешних зависимостей)
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fcg-xvii/containers"
+)
+
+// Источник показателей хранилища (Cache, TypedCache)
+type CacheSource interface {
+	Len() int
+	Stats() containers.CacheStats
+}
+
+// Источник показателей файлового контейнера (FileObject, FileList, FileMap)
+type FileSource interface {
+	Reloads() int64
+	ParseErrors() int64
+}
+
+// Реестр по умолчанию, публикуемый в expvar под именем "containers"
+var Default = NewRegistry()
+
+func init() {
+	Default.Publish("containers")
+}
+
+// Регистрация хранилища в реестре по умолчанию
+func RegisterCache(name string, source CacheSource) { Default.RegisterCache(name, source) }
+
+// Регистрация файлового контейнера в реестре по умолчанию
+func RegisterFile(name string, source FileSource) { Default.RegisterFile(name, source) }
+
+// Конструктор реестра источников показателей
+func NewRegistry() *Registry {
+	return &Registry{
+		caches: make(map[string]CacheSource),
+		files:  make(map[string]FileSource),
+	}
+}
+
+// Реестр источников показателей, в котором хранилища и файловые контейнеры идентифицируются пользовательскими именами
+type Registry struct {
+	locker sync.RWMutex
+	caches map[string]CacheSource
+	files  map[string]FileSource
+}
+
+// Регистрация хранилища под именем name (повторная регистрация заменяет источник)
+func (s *Registry) RegisterCache(name string, source CacheSource) {
+	s.locker.Lock()
+	s.caches[name] = source
+	s.locker.Unlock()
+}
+
+// Регистрация файлового контейнера под именем name (повторная регистрация заменяет источник)
+func (s *Registry) RegisterFile(name string, source FileSource) {
+	s.locker.Lock()
+	s.files[name] = source
+	s.locker.Unlock()
+}
+
+// Удаление хранилища и файлового контейнера с именем name из реестра
+func (s *Registry) Unregister(name string) {
+	s.locker.Lock()
+	delete(s.caches, name)
+	delete(s.files, name)
+	s.locker.Unlock()
+}
+
+// Показатели хранилища в формате expvar
+type CacheValues struct {
+	Len          int
+	Hits         int64
+	Misses       int64
+	HitRatio     float64
+	Loads        int64
+	LoadErrors   int64
+	LoadDuration float64 // Суммарная длительность загрузок в секундах
+	Expirations  int64
+	Deletes      int64
+	Evictions    int64
+}
+
+// Показатели файлового контейнера в формате expvar
+type FileValues struct {
+	Reloads     int64
+	ParseErrors int64
+}
+
+// Показатели всех зарегистрированных источников
+type Values struct {
+	Caches map[string]CacheValues
+	Files  map[string]FileValues
+}
+
+// Текущие показатели всех зарегистрированных источников
+func (s *Registry) Values() Values {
+	res := Values{make(map[string]CacheValues), make(map[string]FileValues)}
+	s.locker.RLock()
+	for name, source := range s.caches {
+		stats := source.Stats()
+		res.Caches[name] = CacheValues{
+			Len:          source.Len(),
+			Hits:         stats.Hits,
+			Misses:       stats.Misses,
+			HitRatio:     stats.HitRatio(),
+			Loads:        stats.Loads,
+			LoadErrors:   stats.LoadErrors,
+			LoadDuration: stats.LoadDuration.Seconds(),
+			Expirations:  stats.Expirations,
+			Deletes:      stats.Deletes,
+			Evictions:    stats.Evictions,
+		}
+	}
+	for name, source := range s.files {
+		res.Files[name] = FileValues{source.Reloads(), source.ParseErrors()}
+	}
+	s.locker.RUnlock()
+	return res
+}
+
+// Публикация показателей реестра в expvar под именем name
+func (s *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return s.Values() }))
+}
+
+// Описание метрики в формате Prometheus
+type metric[T any] struct {
+	name, help, kind string
+	value            func(T) float64
+}
+
+var cacheMetrics = []metric[CacheValues]{
+	{"containers_cache_items", "Number of items in the cache.", "gauge", func(v CacheValues) float64 { return float64(v.Len) }},
+	{"containers_cache_hits_total", "Number of cache lookups that found an item.", "counter", func(v CacheValues) float64 { return float64(v.Hits) }},
+	{"containers_cache_misses_total", "Number of cache lookups that did not find an item.", "counter", func(v CacheValues) float64 { return float64(v.Misses) }},
+	{"containers_cache_hit_ratio", "Ratio of cache hits to all lookups.", "gauge", func(v CacheValues) float64 { return v.HitRatio }},
+	{"containers_cache_loads_total", "Number of item creations and loads.", "counter", func(v CacheValues) float64 { return float64(v.Loads) }},
+	{"containers_cache_load_errors_total", "Number of failed item creations and loads.", "counter", func(v CacheValues) float64 { return float64(v.LoadErrors) }},
+	{"containers_cache_load_duration_seconds_total", "Total time spent creating and loading items.", "counter", func(v CacheValues) float64 { return v.LoadDuration }},
+	{"containers_cache_expirations_total", "Number of items removed by the cleaner.", "counter", func(v CacheValues) float64 { return float64(v.Expirations) }},
+	{"containers_cache_deletes_total", "Number of explicitly deleted items.", "counter", func(v CacheValues) float64 { return float64(v.Deletes) }},
+	{"containers_cache_evictions_total", "Number of items evicted by capacity or cost limits.", "counter", func(v CacheValues) float64 { return float64(v.Evictions) }},
+}
+
+var fileMetrics = []metric[FileValues]{
+	{"containers_file_reloads_total", "Number of successful file reloads.", "counter", func(v FileValues) float64 { return float64(v.Reloads) }},
+	{"containers_file_parse_errors_total", "Number of file access, read and parse errors.", "counter", func(v FileValues) float64 { return float64(v.ParseErrors) }},
+}
+
+// Запись показателей всех зарегистрированных источников в текстовом формате Prometheus
+func (s *Registry) WritePrometheus(w io.Writer) error {
+	values := s.Values()
+	bw := bufio.NewWriter(w)
+	writeMetrics(bw, cacheMetrics, "cache", values.Caches)
+	writeMetrics(bw, fileMetrics, "file", values.Files)
+	return bw.Flush()
+}
+
+func writeMetrics[T any](w *bufio.Writer, metrics []metric[T], label string, values map[string]T) {
+	if len(values) == 0 {
+		return
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s{%s=\"%s\"} %v\n", m.name, label, labelReplacer.Replace(name), m.value(values[name]))
+		}
+	}
+}
+
+// Экранирование значения метки согласно текстовому формату Prometheus
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Обработчик HTTP-запросов, отдающий показатели в текстовом формате Prometheus
+func (s *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.WritePrometheus(w)
+}
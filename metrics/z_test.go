@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fcg-xvii/containers"
+)
+
+func TestRegistry(t *testing.T) {
+	cache := containers.NewTypedCache[string, int](time.Second*10, time.Second*15, nil)
+	cache.Set("one", 1)
+	cache.Get("one", nil)
+	cache.Get("two", nil)
+	list := containers.NewFileList("../z-content", func(src []byte, store func(interface{})) error {
+		store(string(src))
+		return nil
+	})
+	list.Len()
+
+	RegisterCache("users", cache)
+	RegisterFile("content", list)
+	defer Default.Unregister("users")
+	defer Default.Unregister("content")
+
+	var buf bytes.Buffer
+	if err := Default.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(buf.String())
+	for _, line := range []string{
+		`containers_cache_items{cache="users"} 1`,
+		`containers_cache_hit_ratio{cache="users"} 0.5`,
+		`containers_file_reloads_total{file="content"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatal("metric not found:", line)
+		}
+	}
+
+	var values Values
+	if err := json.Unmarshal([]byte(expvar.Get("containers").String()), &values); err != nil {
+		t.Fatal(err)
+	}
+	if values.Caches["users"].Hits != 1 || values.Files["content"].Reloads != 1 {
+		t.Fatal("unexpected expvar values", values)
+	}
+}
@@ -0,0 +1,297 @@
+package containers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fcg-xvii/containers/clock"
+)
+
+// Ошибка недопустимого сочетания параметров хранилища (см. New)
+var ErrInvalidOption = errors.New("Invalid cache option")
+
+// Параметр хранилища, передаваемый в конструкторы New и NewTyped
+type Option func(*cacheOptions) error
+
+// Набор параметров хранилища. Параметры, зависящие от типов ключей и значений, хранятся как interface{}
+// и приводятся к типам хранилища при его создании
+type cacheOptions struct {
+	interval, ttl time.Duration
+	mode          ExpirationMode
+	maxAge        time.Duration
+	errorTTL      time.Duration
+	capacity      int
+	maxCost       int64
+	shards        int
+	noStats       bool
+	removeOnGet   bool
+	refreshAhead  time.Duration
+	staleGrace    time.Duration
+	clock         clock.Clock
+	codec         Codec
+	policy        interface{} // PolicyConstructor[K]
+	weigher       interface{} // func(K, V) int64
+	onEvict       interface{} // TypedEvictMethod[K, V]
+	clearPrepare  interface{} // func([]V)
+	loader        interface{} // TypedContextLoadMethod[K, V]
+}
+
+// Ошибка параметра хранилища
+func invalidOption(format string, args ...interface{}) error {
+	return fmt.Errorf("%w :: %s", ErrInvalidOption, fmt.Sprintf(format, args...))
+}
+
+// Интервал активации клинера, удаляющего устаревшие объекты
+func WithInterval(interval time.Duration) Option {
+	return func(o *cacheOptions) error {
+		if interval < 0 {
+			return invalidOption("negative cleaner interval %v", interval)
+		}
+		o.interval = interval
+		return nil
+	}
+}
+
+// Время жизни объектов по умолчанию (0 - без ограничения). Требует указания интервала клинера (WithInterval)
+func WithTTL(ttl time.Duration) Option {
+	return func(o *cacheOptions) error {
+		if ttl < 0 {
+			return invalidOption("negative ttl %v", ttl)
+		}
+		o.ttl = ttl
+		return nil
+	}
+}
+
+// Режим истечения времени жизни объектов (см. SetExpirationMode)
+func WithExpirationMode(mode ExpirationMode, maxAge time.Duration) Option {
+	return func(o *cacheOptions) error {
+		if (mode == EXPIRE_SLIDING_MAX_AGE) != (maxAge > 0) {
+			return invalidOption("max age %v is incompatible with mode %v", maxAge, mode)
+		}
+		o.mode, o.maxAge = mode, maxAge
+		return nil
+	}
+}
+
+// Время кэширования ошибок загрузки (см. SetErrorTTL)
+func WithErrorTTL(ttl time.Duration) Option {
+	return func(o *cacheOptions) error {
+		if ttl < 0 {
+			return invalidOption("negative error ttl %v", ttl)
+		}
+		o.errorTTL = ttl
+		return nil
+	}
+}
+
+// Максимальное количество объектов в хранилище (см. NewLRUCache). В сегментированном хранилище (WithShards)
+// ограничение делится между сегментами (их сумма равна capacity), поэтому при неравномерном распределении ключей
+// вытеснение может начаться до достижения capacity. Вместимость, меньшая количества сегментов, недопустима
+func WithCapacity(capacity int) Option {
+	return func(o *cacheOptions) error {
+		if capacity < 0 {
+			return invalidOption("negative capacity %v", capacity)
+		}
+		o.capacity = capacity
+		return nil
+	}
+}
+
+// Максимальная суммарная стоимость объектов в хранилище (см. NewWeightedCache). Как и вместимость (WithCapacity),
+// делится поровну между сегментами и не может быть меньше их количества
+func WithMaxCost(maxCost int64) Option {
+	return func(o *cacheOptions) error {
+		if maxCost < 0 {
+			return invalidOption("negative max cost %v", maxCost)
+		}
+		o.maxCost = maxCost
+		return nil
+	}
+}
+
+// Метод расчёта стоимости объекта. Требует ограничения суммарной стоимости (WithMaxCost)
+func WithWeigher[K comparable, V any](weigher func(key K, value V) int64) Option {
+	return func(o *cacheOptions) error {
+		if weigher != nil {
+			o.weigher = weigher
+		}
+		return nil
+	}
+}
+
+// Политика вытеснения объектов. Требует ограничения вместимости (WithCapacity) или стоимости (WithMaxCost)
+func WithPolicy[K comparable](policy PolicyConstructor[K]) Option {
+	return func(o *cacheOptions) error {
+		if policy != nil {
+			o.policy = policy
+		}
+		return nil
+	}
+}
+
+// Метод, вызываемый при удалении объекта из хранилища (см. OnEvict)
+func WithOnEvict[K comparable, V any](method TypedEvictMethod[K, V]) Option {
+	return func(o *cacheOptions) error {
+		o.onEvict = method
+		return nil
+	}
+}
+
+// Метод, в который передаются объекты, удалённые клинером или вытесненные при переполнении
+func WithClearPrepare[V any](method func([]V)) Option {
+	return func(o *cacheOptions) error {
+		o.clearPrepare = method
+		return nil
+	}
+}
+
+// Загрузчик объектов по умолчанию, используемый методами Load и GetOrLoad при вызове без загрузчика
+func WithLoader[K comparable, V any](loader TypedContextLoadMethod[K, V]) Option {
+	return func(o *cacheOptions) error {
+		o.loader = loader
+		return nil
+	}
+}
+
+// Источник времени хранилища (см. SetClock)
+func WithClock(c clock.Clock) Option {
+	return func(o *cacheOptions) error {
+		o.clock = c
+		return nil
+	}
+}
+
+// Количество сегментов хранилища (см. NewShardedCache)
+func WithShards(shards int) Option {
+	return func(o *cacheOptions) error {
+		if shards < 1 {
+			return invalidOption("shards count %v must be positive", shards)
+		}
+		o.shards = shards
+		return nil
+	}
+}
+
+// Включение или отключение сбора статистики (по умолчанию статистика собирается)
+func WithStats(enabled bool) Option {
+	return func(o *cacheOptions) error {
+		o.noStats = !enabled
+		return nil
+	}
+}
+
+// Удаление объектов, время жизни которых истекло, при обращении к ним (см. SetRemoveExpiredOnGet)
+func WithRemoveExpiredOnGet(enabled bool) Option {
+	return func(o *cacheOptions) error {
+		o.removeOnGet = enabled
+		return nil
+	}
+}
+
+// Окно фонового обновления объектов до истечения их времени жизни (см. SetRefreshAhead)
+func WithRefreshAhead(window time.Duration) Option {
+	return func(o *cacheOptions) error {
+		if window < 0 {
+			return invalidOption("negative refresh window %v", window)
+		}
+		o.refreshAhead = window
+		return nil
+	}
+}
+
+// Период выдачи устаревших объектов на время их фонового обновления (см. SetStaleWhileRevalidate)
+func WithStaleWhileRevalidate(grace time.Duration) Option {
+	return func(o *cacheOptions) error {
+		if grace < 0 {
+			return invalidOption("negative stale grace period %v", grace)
+		}
+		o.staleGrace = grace
+		return nil
+	}
+}
+
+// Формат сохранения снимков хранилища (см. SetCodec)
+func WithCodec(codec Codec) Option {
+	return func(o *cacheOptions) error {
+		o.codec = codec
+		return nil
+	}
+}
+
+// Приведение параметра, зависящего от типов ключей и значений, к типу хранилища
+func typedOption[T any](name string, val interface{}) (res T, err error) {
+	if val != nil {
+		var check bool
+		if res, check = val.(T); !check {
+			err = invalidOption("%s of type %T does not match cache type %T", name, val, res)
+		}
+	}
+	return
+}
+
+// Формирование параметров хранилища с проверкой их сочетаний
+func buildConfig[K comparable, V any](opts []Option) (config cacheConfig[K, V], err error) {
+	var o cacheOptions
+	for _, opt := range opts {
+		if err = opt(&o); err != nil {
+			return
+		}
+	}
+	if o.ttl > 0 && o.interval == 0 {
+		return config, invalidOption("ttl %v requires cleaner interval", o.ttl)
+	}
+	if o.policy != nil && o.capacity == 0 && o.maxCost == 0 {
+		return config, invalidOption("eviction policy requires capacity or max cost")
+	}
+	if o.weigher != nil && o.maxCost == 0 {
+		return config, invalidOption("weigher requires max cost")
+	}
+	if o.capacity > 0 && o.capacity < o.shards {
+		return config, invalidOption("capacity %v is less than shards count %v", o.capacity, o.shards)
+	}
+	if o.maxCost > 0 && o.maxCost < int64(o.shards) {
+		return config, invalidOption("max cost %v is less than shards count %v", o.maxCost, o.shards)
+	}
+	config = cacheConfig[K, V]{
+		interval: o.interval, expired: o.ttl, mode: o.mode, maxAge: o.maxAge, errorTTL: o.errorTTL,
+		capacity: o.capacity, maxCost: o.maxCost, shards: o.shards, noStats: o.noStats,
+		clock: o.clock, codec: o.codec, removeOnGet: o.removeOnGet,
+		refreshAhead: o.refreshAhead, staleGrace: o.staleGrace,
+	}
+	if config.policy, err = typedOption[PolicyConstructor[K]]("policy", o.policy); err != nil {
+		return
+	}
+	if config.weigher, err = typedOption[func(K, V) int64]("weigher", o.weigher); err != nil {
+		return
+	}
+	if config.onEvict, err = typedOption[TypedEvictMethod[K, V]]("evict method", o.onEvict); err != nil {
+		return
+	}
+	if config.clearPrepare, err = typedOption[func([]V)]("clear prepare method", o.clearPrepare); err != nil {
+		return
+	}
+	config.loader, err = typedOption[TypedContextLoadMethod[K, V]]("loader", o.loader)
+	return
+}
+
+// Конструктор объекта кэша с параметрами opts. Возвращает ErrInvalidOption при недопустимом значении параметра,
+// несовместимом сочетании параметров (например, времени жизни объектов без интервала клинера) или при несовпадении
+// типов параметров с типом хранилища (ключи и значения Cache имеют тип interface{})
+func New(opts ...Option) (*Cache, error) {
+	config, err := buildConfig[interface{}, interface{}](opts)
+	if err != nil {
+		return nil, err
+	}
+	return newCacheWrapper(config), nil
+}
+
+// Конструктор типизированного объекта кэша с параметрами opts (аналогичен New)
+func NewTyped[K comparable, V any](opts ...Option) (*TypedCache[K, V], error) {
+	config, err := buildConfig[K, V](opts)
+	if err != nil {
+		return nil, err
+	}
+	return newTypedCacheWrapper(config), nil
+}
@@ -0,0 +1,329 @@
+package containers
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// Политика вытеснения объектов из хранилища ограниченной вместимости.
+// Методы политики вызываются хранилищем под блокировкой, поэтому реализация может не заботиться о синхронизации
+type EvictionPolicy[K comparable] interface {
+	Add(key K)        // Новый ключ помещён в хранилище
+	Access(key K)     // Обращение к существующему ключу (чтение или перезапись)
+	Remove(key K)     // Ключ удалён из хранилища без участия политики (клинером или явным удалением)
+	Evict() (K, bool) // Выбор ключа для вытеснения. Выбранный ключ перестаёт отслеживаться политикой
+}
+
+// Конструктор политики вытеснения. Принимает вместимость хранилища, для которого создаётся политика.
+// Для хранилища, ограниченного только стоимостью объектов, вместимость равна 0: политика, которой требуется
+// вместимость, должна ориентироваться на текущее количество отслеживаемых ею объектов
+type PolicyConstructor[K comparable] func(capacity int) EvictionPolicy[K]
+
+////////////////////////////////////////////////////////////////////////////
+
+// Список ключей с быстрым поиском элемента по ключу
+type keyList[K comparable] struct {
+	list  *list.List
+	index map[K]*list.Element
+}
+
+func newKeyList[K comparable]() *keyList[K] {
+	return &keyList[K]{list.New(), make(map[K]*list.Element)}
+}
+
+func (s *keyList[K]) Len() int { return s.list.Len() }
+
+func (s *keyList[K]) contains(key K) bool {
+	_, check := s.index[key]
+	return check
+}
+
+func (s *keyList[K]) pushFront(key K) {
+	s.index[key] = s.list.PushFront(key)
+}
+
+func (s *keyList[K]) moveToFront(key K) bool {
+	if el, check := s.index[key]; check {
+		s.list.MoveToFront(el)
+		return true
+	}
+	return false
+}
+
+func (s *keyList[K]) remove(key K) bool {
+	if el, check := s.index[key]; check {
+		s.list.Remove(el)
+		delete(s.index, key)
+		return true
+	}
+	return false
+}
+
+func (s *keyList[K]) popBack() (key K, check bool) {
+	if el := s.list.Back(); el != nil {
+		key, check = el.Value.(K), true
+		s.list.Remove(el)
+		delete(s.index, key)
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////////
+
+// Конструктор политики LRU - вытесняется объект, к которому дольше всего не было обращений
+func NewLRUPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return &lruPolicy[K]{newKeyList[K]()}
+}
+
+type lruPolicy[K comparable] struct {
+	keys *keyList[K]
+}
+
+func (s *lruPolicy[K]) Add(key K)        { s.keys.pushFront(key) }
+func (s *lruPolicy[K]) Access(key K)     { s.keys.moveToFront(key) }
+func (s *lruPolicy[K]) Remove(key K)     { s.keys.remove(key) }
+func (s *lruPolicy[K]) Evict() (K, bool) { return s.keys.popBack() }
+
+////////////////////////////////////////////////////////////////////////////
+
+// Конструктор политики FIFO - вытесняется объект, дольше всех находящийся в хранилище, независимо от обращений к нему
+func NewFIFOPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return &fifoPolicy[K]{newKeyList[K]()}
+}
+
+type fifoPolicy[K comparable] struct {
+	keys *keyList[K]
+}
+
+func (s *fifoPolicy[K]) Add(key K)        { s.keys.pushFront(key) }
+func (s *fifoPolicy[K]) Access(key K)     {}
+func (s *fifoPolicy[K]) Remove(key K)     { s.keys.remove(key) }
+func (s *fifoPolicy[K]) Evict() (K, bool) { return s.keys.popBack() }
+
+////////////////////////////////////////////////////////////////////////////
+
+// Конструктор политики LFU - вытесняется объект с наименьшим количеством обращений
+// (при равенстве количества обращений - объект, к которому дольше всего не обращались)
+func NewLFUPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return &lfuPolicy[K]{index: make(map[K]*lfuEntry[K])}
+}
+
+type lfuEntry[K comparable] struct {
+	key   K
+	freq  int64 // Количество обращений
+	tick  int64 // Порядковый номер последнего обращения
+	index int   // Позиция в куче
+}
+
+type lfuPolicy[K comparable] struct {
+	entries lfuHeap[K]
+	index   map[K]*lfuEntry[K]
+	tick    int64
+}
+
+func (s *lfuPolicy[K]) Add(key K) {
+	s.tick++
+	entry := &lfuEntry[K]{key: key, freq: 1, tick: s.tick}
+	s.index[key] = entry
+	heap.Push(&s.entries, entry)
+}
+
+func (s *lfuPolicy[K]) Access(key K) {
+	if entry, check := s.index[key]; check {
+		s.tick++
+		entry.freq, entry.tick = entry.freq+1, s.tick
+		heap.Fix(&s.entries, entry.index)
+	}
+}
+
+func (s *lfuPolicy[K]) Remove(key K) {
+	if entry, check := s.index[key]; check {
+		heap.Remove(&s.entries, entry.index)
+		delete(s.index, key)
+	}
+}
+
+func (s *lfuPolicy[K]) Evict() (key K, check bool) {
+	if len(s.entries) > 0 {
+		entry := heap.Pop(&s.entries).(*lfuEntry[K])
+		delete(s.index, entry.key)
+		key, check = entry.key, true
+	}
+	return
+}
+
+// Куча записей LFU (на вершине - запись с наименьшим количеством обращений)
+type lfuHeap[K comparable] []*lfuEntry[K]
+
+func (s lfuHeap[K]) Len() int { return len(s) }
+
+func (s lfuHeap[K]) Less(i, j int) bool {
+	if s[i].freq == s[j].freq {
+		return s[i].tick < s[j].tick
+	}
+	return s[i].freq < s[j].freq
+}
+
+func (s lfuHeap[K]) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+	s[i].index, s[j].index = i, j
+}
+
+func (s *lfuHeap[K]) Push(x interface{}) {
+	entry := x.(*lfuEntry[K])
+	entry.index = len(*s)
+	*s = append(*s, entry)
+}
+
+func (s *lfuHeap[K]) Pop() interface{} {
+	old := *s
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*s = old[:len(old)-1]
+	return entry
+}
+
+////////////////////////////////////////////////////////////////////////////
+
+// Конструктор политики ARC (Adaptive Replacement Cache). Политика разделяет объекты на использованные однократно (t1)
+// и многократно (t2), запоминает ключи недавно вытесненных объектов (b1, b2) и на их основе подстраивает
+// соотношение между списками, что защищает часто используемые объекты от вытеснения при последовательном сканировании
+func NewARCPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return &arcPolicy[K]{
+		capacity: capacity,
+		t1:       newKeyList[K](), t2: newKeyList[K](),
+		b1: newKeyList[K](), b2: newKeyList[K](),
+	}
+}
+
+type arcPolicy[K comparable] struct {
+	capacity       int         // Вместимость хранилища (0 - текущее количество объектов)
+	p              int         // Целевой размер списка t1
+	t1, t2         *keyList[K] // Ключи объектов в хранилище
+	b1, b2         *keyList[K] // Ключи вытесненных объектов ("призраки")
+	lastFromGhost2 bool        // Последний добавленный ключ был найден в b2
+}
+
+func (s *arcPolicy[K]) Add(key K) {
+	s.lastFromGhost2 = false
+	switch {
+	case s.b1.contains(key):
+		s.p = min(s.limit(), s.p+max(s.b2.Len()/max(s.b1.Len(), 1), 1))
+		s.b1.remove(key)
+		s.t2.pushFront(key)
+	case s.b2.contains(key):
+		s.p = max(0, s.p-max(s.b1.Len()/max(s.b2.Len(), 1), 1))
+		s.b2.remove(key)
+		s.t2.pushFront(key)
+		s.lastFromGhost2 = true
+	default:
+		s.t1.pushFront(key)
+	}
+}
+
+func (s *arcPolicy[K]) Access(key K) {
+	if s.t1.remove(key) {
+		s.t2.pushFront(key)
+	} else {
+		s.t2.moveToFront(key)
+	}
+}
+
+func (s *arcPolicy[K]) Remove(key K) {
+	if !s.t1.remove(key) {
+		s.t2.remove(key)
+	}
+}
+
+func (s *arcPolicy[K]) Evict() (key K, check bool) {
+	if s.t1.Len() > 0 && (s.t1.Len() > s.p || (s.lastFromGhost2 && s.t1.Len() == s.p) || s.t2.Len() == 0) {
+		if key, check = s.t1.popBack(); check {
+			s.b1.pushFront(key)
+		}
+	} else if key, check = s.t2.popBack(); check {
+		s.b2.pushFront(key)
+	}
+	s.trimGhosts()
+	return
+}
+
+// Вместимость, относительно которой ограничиваются списки политики
+func (s *arcPolicy[K]) limit() int {
+	if s.capacity > 0 {
+		return s.capacity
+	}
+	return max(s.t1.Len()+s.t2.Len(), 1)
+}
+
+// Ограничение размера списков вытесненных ключей
+func (s *arcPolicy[K]) trimGhosts() {
+	limit := s.limit()
+	for s.b1.Len() > 0 && s.t1.Len()+s.b1.Len() > limit {
+		s.b1.popBack()
+	}
+	for s.b1.Len()+s.b2.Len() > 0 && s.t1.Len()+s.t2.Len()+s.b1.Len()+s.b2.Len() > 2*limit {
+		if _, check := s.b2.popBack(); !check {
+			s.b1.popBack()
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////
+
+// Конструктор политики 2Q. Новые объекты попадают в очередь a1in (FIFO) и, будучи вытесненными из неё,
+// запоминаются в a1out. Повторно добавленный объект, ключ которого есть в a1out, попадает в основной список am (LRU).
+// Однократно использованные объекты не вытесняют из am часто используемые
+func New2QPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return &twoQueuePolicy[K]{
+		capacity: capacity,
+		a1in:     newKeyList[K](), a1out: newKeyList[K](), am: newKeyList[K](),
+	}
+}
+
+type twoQueuePolicy[K comparable] struct {
+	capacity int         // Вместимость хранилища (0 - текущее количество объектов)
+	a1in     *keyList[K] // Новые объекты в хранилище
+	a1out    *keyList[K] // Ключи объектов, вытесненных из a1in
+	am       *keyList[K] // Часто используемые объекты в хранилище
+}
+
+// Предельные размеры очередей a1in и a1out
+func (s *twoQueuePolicy[K]) limits() (kIn, kOut int) {
+	capacity := s.capacity
+	if capacity <= 0 {
+		capacity = s.a1in.Len() + s.am.Len()
+	}
+	return max(capacity/4, 1), max(capacity/2, 1)
+}
+
+func (s *twoQueuePolicy[K]) Add(key K) {
+	if s.a1out.remove(key) {
+		s.am.pushFront(key)
+	} else {
+		s.a1in.pushFront(key)
+	}
+}
+
+func (s *twoQueuePolicy[K]) Access(key K) {
+	s.am.moveToFront(key)
+}
+
+func (s *twoQueuePolicy[K]) Remove(key K) {
+	if !s.a1in.remove(key) {
+		s.am.remove(key)
+	}
+}
+
+func (s *twoQueuePolicy[K]) Evict() (key K, check bool) {
+	kIn, kOut := s.limits()
+	if s.a1in.Len() > kIn || s.am.Len() == 0 {
+		if key, check = s.a1in.popBack(); check {
+			s.a1out.pushFront(key)
+			for s.a1out.Len() > kOut {
+				s.a1out.popBack()
+			}
+			return
+		}
+	}
+	return s.am.popBack()
+}
@@ -0,0 +1,83 @@
+package containers
+
+import "sort"
+
+// Конструктор кэша со строковыми ключами, поддерживающего операции над группами ключей с общим префиксом
+// (например, удаление всех ключей вида "user:42:*"). Принимает те же параметры, что и NewTyped
+func NewPrefixCache[V any](opts ...Option) (*PrefixCache[V], error) {
+	config, err := buildConfig[string, V](opts)
+	if err != nil {
+		return nil, err
+	}
+	config.indexer = newRadixTree
+	return &PrefixCache[V]{newTypedCacheWrapper(config)}, nil
+}
+
+// Кэш со строковыми ключами. Помимо методов TypedCache поддерживает выборку и удаление объектов по префиксу ключа.
+// Ключи каждого сегмента дополнительно хранятся в префиксном (radix) дереве, поэтому операции с префиксом
+// затрагивают только соответствующие ему ключи. Время жизни объектов истекает так же, как в Cache
+type PrefixCache[V any] struct {
+	*TypedCache[string, V]
+}
+
+// Обход ключей сегмента с префиксом prefix (вызывается при блокировке сегмента)
+func walkShardPrefix[V any](shard *cacheShard[string, V], prefix string, callback func(string) bool) {
+	shard.index.(*radixTree).walkPrefix(prefix, callback)
+}
+
+// Выборка актуальных объектов с префиксом ключа prefix, упорядоченных по ключу
+func (s *PrefixCache[V]) collectPrefix(prefix string) (keys []string, values map[string]V) {
+	values = make(map[string]V)
+	for _, shard := range s.shards {
+		shard.locker.RLock()
+		now := shard.clock.Now().UnixNano()
+		walkShardPrefix(shard, prefix, func(key string) bool {
+			if item := shard.items[key]; shard.itemState(item, now) != itemExpired {
+				keys, values[key] = append(keys, key), item.object
+			}
+			return true
+		})
+		shard.locker.RUnlock()
+	}
+	if len(s.shards) > 1 {
+		sort.Strings(keys)
+	}
+	return
+}
+
+// Возвращает упорядоченный список ключей с префиксом prefix
+func (s *PrefixCache[V]) KeysWithPrefix(prefix string) []string {
+	keys, _ := s.collectPrefix(prefix)
+	return keys
+}
+
+// Обход объектов с префиксом ключа prefix в порядке возрастания ключей. Обход прекращается, если callback
+// возвращает false. Как и в Range, callback вызывается без блокировки хранилища
+func (s *PrefixCache[V]) RangePrefix(prefix string, callback func(key string, value V) bool) {
+	keys, values := s.collectPrefix(prefix)
+	for _, key := range keys {
+		if !callback(key, values[key]) {
+			return
+		}
+	}
+}
+
+// Удаление всех объектов с префиксом ключа prefix. Удаление выполняется при блокировке всех сегментов,
+// удалённые объекты передаются в метод OnEvict с причиной EVICT_DELETED. Возвращает количество удалённых объектов
+func (s *PrefixCache[V]) DeletePrefix(prefix string) (res int) {
+	s.lockAll()
+	for _, shard := range s.shards {
+		var keys []string
+		walkShardPrefix(shard, prefix, func(key string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		for _, key := range keys {
+			shard.delete(key)
+			s.stats.delete()
+		}
+		res += len(keys)
+	}
+	s.unlockAll()
+	return
+}
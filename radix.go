@@ -0,0 +1,142 @@
+package containers
+
+import (
+	"sort"
+	"strings"
+)
+
+// Упорядоченный индекс ключей сегмента, поддерживаемый хранилищем при помещении и удалении объектов
+type keyIndex[K comparable] interface {
+	add(key K)
+	remove(key K)
+}
+
+// Создание индекса ключей сегмента (nil, если индекс хранилищу не требуется)
+func (s *cacheConfig[K, V]) newIndex() keyIndex[K] {
+	if s.indexer == nil {
+		return nil
+	}
+	return s.indexer()
+}
+
+////////////////////////////////////////////////////////////////////////////
+
+// Узел сжатого префиксного (radix) дерева строковых ключей
+type radixNode struct {
+	prefix   string       // Часть ключа, соответствующая ребру от родительского узла
+	children []*radixNode // Дочерние узлы, упорядоченные по первому байту префикса
+	leaf     bool         // Узел соответствует ключу индекса
+}
+
+// Поиск дочернего узла, префикс которого начинается с байта b. Возвращает позицию узла
+// (или позицию для вставки нового узла) и найденный узел
+func (s *radixNode) child(b byte) (int, *radixNode) {
+	i := sort.Search(len(s.children), func(i int) bool { return s.children[i].prefix[0] >= b })
+	if i < len(s.children) && s.children[i].prefix[0] == b {
+		return i, s.children[i]
+	}
+	return i, nil
+}
+
+// Объединение узла с единственным дочерним узлом
+func (s *radixNode) merge() {
+	child := s.children[0]
+	s.prefix, s.children, s.leaf = s.prefix+child.prefix, child.children, child.leaf
+}
+
+// Обход ключей поддерева в лексикографическом порядке. Возвращает false, если обход прерван методом callback
+func (s *radixNode) walk(key string, callback func(string) bool) bool {
+	if s.leaf && !callback(key) {
+		return false
+	}
+	for _, child := range s.children {
+		if !child.walk(key+child.prefix, callback) {
+			return false
+		}
+	}
+	return true
+}
+
+// Сжатое префиксное дерево строковых ключей (используется PrefixCache для выборки ключей по префиксу)
+type radixTree struct {
+	root radixNode
+}
+
+func newRadixTree() keyIndex[string] {
+	return new(radixTree)
+}
+
+func (s *radixTree) add(key string) {
+	node := &s.root
+	for key != "" {
+		i, child := node.child(key[0])
+		if child == nil {
+			node.children = append(node.children, nil)
+			copy(node.children[i+1:], node.children[i:])
+			node.children[i] = &radixNode{prefix: key, leaf: true}
+			return
+		}
+		common := 0
+		for common < len(key) && common < len(child.prefix) && key[common] == child.prefix[common] {
+			common++
+		}
+		if common < len(child.prefix) {
+			// Ключ расходится с префиксом дочернего узла, разделяем узел
+			split := &radixNode{prefix: child.prefix[:common], children: []*radixNode{child}}
+			child.prefix = child.prefix[common:]
+			node.children[i] = split
+			child = split
+		}
+		node, key = child, key[common:]
+	}
+	node.leaf = true
+}
+
+func (s *radixTree) remove(key string) {
+	var parent *radixNode
+	node, index := &s.root, 0
+	for key != "" {
+		i, child := node.child(key[0])
+		if child == nil || !strings.HasPrefix(key, child.prefix) {
+			return
+		}
+		parent, node, index, key = node, child, i, key[len(child.prefix):]
+	}
+	if !node.leaf {
+		return
+	}
+	if node.leaf = false; parent == nil {
+		return
+	}
+	// Удаляем лишние узлы, чтобы дерево оставалось сжатым
+	switch len(node.children) {
+	case 0:
+		parent.children = append(parent.children[:index], parent.children[index+1:]...)
+		if parent != &s.root && !parent.leaf && len(parent.children) == 1 {
+			parent.merge()
+		}
+	case 1:
+		node.merge()
+	}
+}
+
+// Обход ключей с префиксом prefix в лексикографическом порядке (до первого false, возвращённого callback)
+func (s *radixTree) walkPrefix(prefix string, callback func(string) bool) {
+	node, key := &s.root, ""
+	for prefix != "" {
+		_, child := node.child(prefix[0])
+		switch {
+		case child == nil:
+			return
+		case strings.HasPrefix(prefix, child.prefix):
+			prefix = prefix[len(child.prefix):]
+		case strings.HasPrefix(child.prefix, prefix):
+			// Префикс заканчивается внутри ребра, все ключи поддерева ему соответствуют
+			prefix = ""
+		default:
+			return
+		}
+		node, key = child, key+child.prefix
+	}
+	node.walk(key, callback)
+}
@@ -0,0 +1,54 @@
+package containers
+
+// Копирование актуальных объектов сегмента (объекты, время жизни которых истекло, пропускаются)
+func (s *cacheShard[K, V]) copyItems(dst map[K]V) {
+	s.locker.RLock()
+	now := s.clock.Now().UnixNano()
+	for key, item := range s.items {
+		if s.itemState(item, now) != itemExpired {
+			dst[key] = item.object
+		}
+	}
+	s.locker.RUnlock()
+}
+
+// Обход объектов хранилища. Обход прекращается, если callback возвращает false. Объекты каждого сегмента
+// копируются при его блокировке, а callback вызывается без блокировки, поэтому в нём допускается обращение
+// к хранилищу. Объекты, изменённые во время обхода, могут быть переданы в callback как с прежним, так и с новым значением
+func (s *cache[K, V]) Range(callback func(key K, value V) bool) {
+	for _, shard := range s.shards {
+		items := make(map[K]V)
+		shard.copyItems(items)
+		for key, value := range items {
+			if !callback(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Копия содержимого хранилища (объекты, время жизни которых истекло, не включаются)
+func (s *cache[K, V]) Snapshot() map[K]V {
+	res := make(map[K]V, s.Len())
+	for _, shard := range s.shards {
+		shard.copyItems(res)
+	}
+	return res
+}
+
+// Удаление объектов, для которых predicate возвращает true (например, всех объектов, относящихся к одному клиенту).
+// Удалённые объекты передаются в метод OnEvict с причиной EVICT_DELETED. Метод predicate вызывается при
+// заблокированном сегменте, поэтому обращение из него к хранилищу недопустимо. Возвращает количество удалённых объектов
+func (s *cache[K, V]) RemoveIf(predicate func(key K, value V) bool) (res int) {
+	for _, shard := range s.shards {
+		shard.locker.Lock()
+		for key, item := range shard.items {
+			if predicate(key, item.object) && shard.delete(key) {
+				s.stats.delete()
+				res++
+			}
+		}
+		shard.unlock()
+	}
+	return
+}
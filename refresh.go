@@ -0,0 +1,78 @@
+package containers
+
+import (
+	"errors"
+	"time"
+)
+
+// Ошибка фонового обновления объекта методом CreateMethod, не создавшим объект с тем же ключом
+var errNotCreated = errors.New("Cache object is not created")
+
+// Преобразование метода создания объекта в метод загрузки для фонового обновления
+func createLoader[K comparable, V any](createCall TypedCreateMethod[K, V]) TypedLoadMethod[K, V] {
+	return func(key K) (res V, err error) {
+		rKey, res, check := createCall(key)
+		if !check || rKey != key {
+			err = errNotCreated
+		}
+		return
+	}
+}
+
+// Установка окна фонового обновления объектов. Если к объекту обращаются менее чем за window до истечения
+// его времени жизни, обращение возвращает текущее значение, а объект загружается заново в отдельной горутине
+// методом, переданным в обращение (GetOrCreate, Load, GetOrLoad) или загрузчиком по умолчанию (Get, см. WithLoader).
+// Одновременно для ключа выполняется не более одной загрузки. Значение <= 0 отключает обновление до истечения
+// времени жизни
+func (s *cache[K, V]) SetRefreshAhead(window time.Duration) {
+	s.lockAll()
+	s.refreshAhead = window
+	s.unlockAll()
+}
+
+// Установка периода, в течение которого после истечения времени жизни объект продолжает выдаваться
+// с запуском фонового обновления (как в SetRefreshAhead). При ошибке обновления устаревшее значение выдаётся
+// до окончания периода grace, после чего объект удаляется. Значение <= 0 отключает выдачу устаревших объектов
+func (s *cache[K, V]) SetStaleWhileRevalidate(grace time.Duration) {
+	s.lockAll()
+	s.staleGrace = grace
+	s.unlockAll()
+}
+
+// Фоновое обновление объекта методом load. Загруженное значение помещается в хранилище методом store,
+// если объект к этому моменту не удалён. Теги прежнего объекта сохраняются, а при store == nil - также время жизни
+// и режим его истечения, а также его стоимость (если не задан метод её расчёта)
+func (s *cache[K, V]) refresh(key K, load TypedLoadMethod[K, V], store func(*cacheShard[K, V], K, V)) {
+	if s.IsClosed() {
+		return
+	}
+	// Обновления учитываются отдельно от загрузок, чтобы Load и GetOrLoad не получали результат чужого метода загрузки
+	call, leader := s.refreshes.start(key)
+	if !leader {
+		// Объект уже обновляется
+		return
+	}
+	go s.refreshes.run(key, call, func() (V, error) {
+		start := time.Now()
+		res, err := load(key)
+		s.stats.load(start, err == nil)
+		if err == nil {
+			shard := s.shard(key)
+			shard.locker.Lock()
+			if old, check := shard.items[key]; check {
+				if store != nil {
+					store(shard, key, res)
+				} else {
+					cost := old.cost
+					if shard.weigher != nil {
+						cost = shard.weigher(key, res)
+					}
+					shard.setItem(key, res, cost, Expiration{TTL: old.ttl, Mode: old.mode, MaxAge: shard.maxAge})
+				}
+				shard.keepTags(key, old)
+			}
+			shard.unlock()
+		}
+		return res, err
+	})
+}
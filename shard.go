@@ -0,0 +1,302 @@
+package containers
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fcg-xvii/containers/clock"
+)
+
+func newCacheShard[K comparable, V any](config *cacheConfig[K, V], capacity int, maxCost int64) *cacheShard[K, V] {
+	res := &cacheShard[K, V]{
+		cacheConfig:     config,
+		locker:          new(sync.RWMutex),
+		items:           make(map[K]*cacheItem[V]),
+		expiry:          newExpiryQueue[K](),
+		index:           config.newIndex(),
+		stopCleanerChan: make(chan bool),
+		capacity:        capacity,
+		maxCost:         maxCost,
+	}
+	if capacity > 0 || maxCost > 0 {
+		// Сегменту, ограниченному только стоимостью, передаётся нулевая вместимость (см. PolicyConstructor)
+		res.evictor = config.policy(max(capacity, 0))
+	}
+	return res
+}
+
+// Сегмент хранилища
+type cacheShard[K comparable, V any] struct {
+	*cacheConfig[K, V]                     // Общие для всех сегментов параметры хранилища
+	locker             *sync.RWMutex       // Мьютекс для работы с картой объектов
+	items              map[K]*cacheItem[V] // Карта объектов
+	expiry             *expiryQueue[K]     // Очередь истечения времени жизни объектов
+	tagged             tagIndex[K]         // Ключи объектов по тегам (см. SetWithTags)
+	index              keyIndex[K]         // Упорядоченный индекс ключей (см. PrefixCache)
+	stopCleanerChan    chan bool           // Канал для остановки клинера (закрывается при закрытии хранилища)
+	cleanerDone        chan bool           // Канал, закрываемый при завершении работы клинера
+	cleanerWork        bool                // Флаг, указывающий на активность клинера
+	cleanerNotifier    int64               // Горутина клинера, оповещающего об удалённых им объектах (см. cleanerUnlock)
+	closed             bool                // Флаг закрытого хранилища (объекты не сохраняются и не выдаются)
+	capacity           int                 // Максимальное количество объектов в сегменте (0 - без ограничений)
+	maxCost            int64               // Максимальная суммарная стоимость объектов в сегменте (0 - без ограничений)
+	cost               int64               // Суммарная стоимость объектов в сегменте
+	evictor            EvictionPolicy[K]   // Политика вытеснения (используется при ограниченной вместимости или стоимости)
+	evictorLocker      sync.Mutex          // Мьютекс политики вытеснения (её состояние изменяется в том числе при чтении)
+	evicted            []evictedItem[K, V] // Удалённые объекты, ожидающие оповещения после снятия блокировки
+	stats              *cacheStats         // Счётчики статистики хранилища
+}
+
+func (s *cacheShard[K, V]) set(key K, value V) {
+	s.setItem(key, value, s.itemCost(key, value), s.expiration(s.expired))
+}
+
+// Параметры истечения времени жизни объекта с заданным ttl согласно режиму хранилища
+func (s *cacheShard[K, V]) expiration(ttl time.Duration) Expiration {
+	return Expiration{TTL: ttl, Mode: s.mode, MaxAge: s.maxAge}
+}
+
+// Расчёт стоимости объекта, для которого она не указана явно
+func (s *cacheShard[K, V]) itemCost(key K, value V) int64 {
+	if s.weigher != nil {
+		return s.weigher(key, value)
+	}
+	return 1
+}
+
+func (s *cacheShard[K, V]) setItem(key K, value V, cost int64, exp Expiration) {
+	expire, deadline := exp.deadlines(s.clock.Now())
+	s.putItem(key, &cacheItem[V]{value, expire, exp.TTL, exp.Mode, deadline, cost, nil})
+}
+
+// Помещение подготовленного элемента в сегмент с вытеснением объектов при переполнении и запуском клинера
+func (s *cacheShard[K, V]) putItem(key K, item *cacheItem[V]) {
+	if s.closed {
+		return
+	}
+	old, exists := s.items[key]
+	if exists {
+		s.cost -= old.cost
+		s.untag(key, old)
+		s.evicted = append(s.evicted, evictedItem[K, V]{key, old.object, EVICT_REPLACED})
+	}
+	s.items[key] = item
+	s.cost += item.cost
+	s.expiry.set(key, item.expire)
+	s.tag(key, item)
+	if !exists && s.index != nil {
+		s.index.add(key)
+	}
+	if s.evictor != nil {
+		s.evictorLocker.Lock()
+		if exists {
+			s.evictor.Access(key)
+		} else {
+			s.evictor.Add(key)
+		}
+		for s.overflow() {
+			vKey, check := s.evictor.Evict()
+			if !check {
+				break
+			}
+			if item, check := s.items[vKey]; check {
+				s.removeItem(vKey, item, EVICT_CAPACITY)
+				s.stats.evict()
+			}
+		}
+		s.evictorLocker.Unlock()
+	}
+	if !s.cleanerWork && item.expire > 0 && s.interval > 0 {
+		// Тикер создаётся до запуска горутины, чтобы сигналы тестовых часов не были пропущены
+		s.cleanerWork, s.cleanerDone = true, make(chan bool)
+		go s.runCleaner(s.clock, s.clock.NewTicker(s.interval), s.cleanerDone)
+	}
+}
+
+// Проверка превышения вместимости или суммарной стоимости сегмента
+func (s *cacheShard[K, V]) overflow() bool {
+	return (s.capacity > 0 && len(s.items) > s.capacity) || (s.maxCost > 0 && s.cost > s.maxCost)
+}
+
+// Уведомление политики вытеснения об обращении к объекту
+func (s *cacheShard[K, V]) policyAccess(key K) {
+	if s.evictor != nil {
+		s.evictorLocker.Lock()
+		s.evictor.Access(key)
+		s.evictorLocker.Unlock()
+	}
+}
+
+// Уведомление политики вытеснения об удалении объекта
+func (s *cacheShard[K, V]) policyRemove(key K) {
+	if s.evictor != nil {
+		s.evictorLocker.Lock()
+		s.evictor.Remove(key)
+		s.evictorLocker.Unlock()
+	}
+}
+
+// Удаление всех объектов сегмента
+func (s *cacheShard[K, V]) reset() {
+	s.items, s.expiry, s.tagged, s.index, s.cost = make(map[K]*cacheItem[V]), newExpiryQueue[K](), nil, s.newIndex(), 0
+}
+
+// Снятие блокировки на запись с оповещением об объектах, удалённых за время блокировки
+func (s *cacheShard[K, V]) unlock() {
+	evicted, onEvict, clearPrepare := s.evicted, s.onEvict, s.clearPrepare
+	s.evicted = nil
+	s.locker.Unlock()
+	if len(evicted) > 0 {
+		notifyEvicted(evicted, onEvict, clearPrepare)
+	}
+}
+
+// Снятие блокировки клинером. Пока клинер оповещает об удалённых объектах, сохраняется идентификатор его горутины,
+// чтобы Close, вызванный из метода OnEvict в этой горутине, не ожидал завершения клинера
+func (s *cacheShard[K, V]) cleanerUnlock() {
+	if len(s.evicted) == 0 {
+		s.locker.Unlock()
+		return
+	}
+	s.cleanerNotifier = goroutineID()
+	s.unlock()
+	s.locker.Lock()
+	s.cleanerNotifier = 0
+	s.locker.Unlock()
+}
+
+// Идентификатор текущей горутины (используется только для распознавания вызова Close из метода OnEvict клинера)
+func goroutineID() int64 {
+	var buf [32]byte
+	// Стек начинается со строки вида "goroutine 18 [running]:"
+	fields := bytes.Fields(buf[:runtime.Stack(buf[:], false)])
+	id, _ := strconv.ParseInt(string(fields[1]), 10, 64)
+	return id
+}
+
+// Состояние найденного объекта относительно истечения его времени жизни
+type itemState byte
+
+const (
+	itemFresh   itemState = iota // Объект актуален
+	itemRefresh                  // Объект выдаётся, но требует фонового обновления (см. SetRefreshAhead)
+	itemExpired                  // Время жизни объекта истекло, объект не выдаётся
+)
+
+// Определение состояния объекта в момент now с учётом окна обновления и периода выдачи устаревших объектов
+func (s *cacheShard[K, V]) itemState(item *cacheItem[V], now int64) itemState {
+	expire := atomic.LoadInt64(&item.expire)
+	switch {
+	case expire == 0:
+		return itemFresh
+	case now > expire+int64(s.staleGrace):
+		return itemExpired
+	case now > expire-int64(s.refreshAhead):
+		return itemRefresh
+	default:
+		return itemFresh
+	}
+}
+
+// Поиск объекта по ключу. Объект, время жизни которого истекло, но который ещё не удалён клинером, не выдаётся
+// (для него возвращается состояние itemExpired). При блокировке сегмента на запись такой объект удаляется сразу,
+// если это разрешено параметром хранилища (см. SetRemoveExpiredOnGet)
+func (s *cacheShard[K, V]) get(key K, cCall TypedCheckMethod[V]) (res V, check bool, state itemState) {
+	if s.closed {
+		return
+	}
+	var item *cacheItem[V]
+	if item, check = s.items[key]; check {
+		now := s.clock.Now()
+		if state = s.itemState(item, now.UnixNano()); state == itemExpired {
+			check = false
+			return
+		}
+		if cCall != nil && !cCall(item.object) {
+			check, state = false, itemFresh
+			return
+		}
+		res = item.object
+		s.policyAccess(key)
+		// Время жизни устаревшего объекта не продлевается, он будет заменён фоновым обновлением
+		if !item.expired(now.UnixNano()) {
+			item.touch(now)
+		}
+	}
+	return
+}
+
+// Удаление объекта, время жизни которого (с учётом периода выдачи устаревших объектов) истекло к моменту now
+// (вызывается при блокировке сегмента на запись). Возвращает false, если объект отсутствует или его время жизни не истекло
+func (s *cacheShard[K, V]) expire(key K, now int64) bool {
+	item, check := s.items[key]
+	if !check || !item.expired(now-int64(s.staleGrace)) {
+		return false
+	}
+	s.policyRemove(key)
+	s.removeItem(key, item, EVICT_EXPIRED)
+	return true
+}
+
+// Удаление объекта из сегмента и его индексов с оповещением о причине удаления после снятия блокировки.
+// Политика вытеснения не уведомляется, так как при вытеснении она уже исключила ключ (см. policyRemove)
+func (s *cacheShard[K, V]) removeItem(key K, item *cacheItem[V], reason EvictReason) {
+	s.evicted = append(s.evicted, evictedItem[K, V]{key, item.object, reason})
+	s.expiry.remove(key)
+	s.untag(key, item)
+	if s.index != nil {
+		s.index.remove(key)
+	}
+	s.cost -= item.cost
+	delete(s.items, key)
+}
+
+// Запуск клинера (запускается при непустой карте объектов и останавливается при пустой)
+func (s *cacheShard[K, V]) runCleaner(c clock.Clock, ticker clock.Ticker, done chan bool) {
+	defer close(done)
+	for {
+		select {
+		case <-ticker.C(): // По сигналу тикера начинаем удаление устаревших объектов
+			now := c.Now().UnixNano()
+			removed := 0
+			s.locker.Lock()
+			// Из очереди извлекаются только объекты, срок которых наступил
+			due := now - int64(s.staleGrace)
+			for key, check := s.expiry.popDue(due); check; key, check = s.expiry.popDue(due) {
+				if s.expire(key, now) {
+					removed++
+				} else if v, check := s.items[key]; check {
+					// Время жизни продлено обращением к объекту, возвращаем его в очередь с новой отметкой
+					s.expiry.set(key, atomic.LoadInt64(&v.expire))
+				}
+			}
+			s.stats.expire(removed)
+			// Если объектов с ограниченным временем жизни не осталось, завершаем работу клинера
+			if s.expiry.Len() == 0 {
+				s.cleanerWork = false
+				ticker.Stop()
+				s.cleanerUnlock()
+				return
+			}
+			s.cleanerUnlock()
+			clock.Ack(ticker)
+		case <-s.stopCleanerChan: // Хранилище закрыто (явно или деструктором, запущеным сборщиком мусора), завершаем работу клинера
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Удаление объекта по ключу. Возвращает false, если объект отсутствовал в сегменте
+func (s *cacheShard[K, V]) delete(key K) bool {
+	item, check := s.items[key]
+	if check {
+		s.policyRemove(key)
+		s.removeItem(key, item, EVICT_DELETED)
+	}
+	return check
+}
@@ -0,0 +1,248 @@
+package containers
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fcg-xvii/containers/clock"
+)
+
+// Кодировщик объектов снимка хранилища
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Декодировщик объектов снимка хранилища
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Формат сохранения снимков хранилища
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+type gobCodec struct{}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder { return gob.NewEncoder(w) }
+func (gobCodec) NewDecoder(r io.Reader) Decoder { return gob.NewDecoder(r) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+func (jsonCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+
+var (
+	// Формат gob (используется по умолчанию). Конкретные типы, хранящиеся в Cache как interface{},
+	// должны быть предварительно зарегистрированы методом gob.Register
+	GobCodec Codec = gobCodec{}
+	// Формат JSON (подходит для TypedCache с ключами и значениями, поддерживающими кодирование в JSON)
+	JSONCodec Codec = jsonCodec{}
+)
+
+// Заголовок снимка хранилища
+type snapshotHeader struct {
+	Count int       // Количество записей в снимке
+	Time  time.Time // Время создания снимка
+}
+
+// Запись снимка хранилища. Временные отметки сохраняются как остаток времени относительно момента создания снимка
+type snapshotItem[K comparable, V any] struct {
+	Key      K
+	Value    V
+	Cost     int64
+	TTL      time.Duration
+	Mode     ExpirationMode
+	Expire   time.Duration // Оставшееся время жизни (0 - без ограничения)
+	Deadline time.Duration // Оставшееся время до достижения максимального возраста (0 - без ограничения)
+	Tags     []string      // Теги объекта
+}
+
+// Остаток времени до временной отметки mark (0 для отсутствующей отметки, отрицательное значение для прошедшей)
+func remaining(mark int64, now time.Time) time.Duration {
+	if mark == 0 {
+		return 0
+	}
+	if res := time.Duration(mark - now.UnixNano()); res != 0 {
+		return res
+	}
+	return -1
+}
+
+// Установка формата сохранения снимков хранилища (по умолчанию GobCodec)
+func (s *cache[K, V]) SetCodec(codec Codec) {
+	s.lockAll()
+	s.codec = codec
+	s.unlockAll()
+}
+
+func (s *cache[K, V]) getCodec() Codec {
+	s.shards[0].locker.RLock()
+	res := s.codec
+	s.shards[0].locker.RUnlock()
+	if res == nil {
+		res = GobCodec
+	}
+	return res
+}
+
+// Сохранение снимка хранилища (ключей, значений и оставшегося времени жизни объектов) в w.
+// Каждый сегмент блокируется только на время копирования его объектов, кодирование выполняется без блокировки
+func (s *cache[K, V]) SaveTo(w io.Writer) error {
+	now := s.Clock().Now()
+	items := make([]snapshotItem[K, V], 0, s.Len())
+	for _, shard := range s.shards {
+		shard.locker.RLock()
+		for key, item := range shard.items {
+			expire, deadline := remaining(item.expire, now), remaining(item.deadline, now)
+			if expire < 0 {
+				continue
+			}
+			items = append(items, snapshotItem[K, V]{key, item.object, item.cost, item.ttl, item.mode, expire, deadline, item.tags})
+		}
+		shard.locker.RUnlock()
+	}
+	enc := s.getCodec().NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{len(items), now}); err != nil {
+		return err
+	}
+	for i := range items {
+		if err := enc.Encode(&items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Восстановление объектов хранилища из снимка, сохранённого методом SaveTo. Время жизни объектов отсчитывается
+// от момента создания снимка, поэтому объекты, время жизни которых истекло, не восстанавливаются.
+// Объекты помещаются в хранилище с учётом ограничений вместимости и стоимости
+func (s *cache[K, V]) LoadFrom(r io.Reader) error {
+	if s.IsClosed() {
+		return ErrClosed
+	}
+	dec, now := s.getCodec().NewDecoder(r), s.Clock().Now()
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+	for i := 0; i < header.Count; i++ {
+		var item snapshotItem[K, V]
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		var expire, deadline int64
+		if item.Expire != 0 {
+			if expire = header.Time.Add(item.Expire).UnixNano(); expire <= now.UnixNano() {
+				continue
+			}
+		}
+		if item.Deadline != 0 {
+			deadline = header.Time.Add(item.Deadline).UnixNano()
+		}
+		shard := s.shard(item.Key)
+		shard.locker.Lock()
+		shard.putItem(item.Key, &cacheItem[V]{item.Value, expire, item.TTL, item.Mode, deadline, item.Cost, item.Tags})
+		shard.unlock()
+	}
+	return nil
+}
+
+// Сохранение снимка хранилища в файл. Снимок записывается во временный файл, который затем
+// переименовывается, поэтому при сбое предыдущий снимок остаётся неповреждённым
+func (s *cache[K, V]) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if err = s.SaveTo(tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Восстановление объектов хранилища из файла снимка
+func (s *cache[K, V]) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.LoadFrom(f)
+}
+
+// Запуск периодического сохранения снимка хранилища в файл path с интервалом interval.
+// Ошибки сохранения передаются в errorCall (при его наличии). Повторный вызов заменяет предыдущие параметры,
+// сохранение останавливается методом StopSnapshots или при закрытии хранилища. Возвращает ErrInvalidOption
+// при interval <= 0 и ErrClosed для закрытого хранилища
+func (s *cache[K, V]) StartSnapshots(path string, interval time.Duration, errorCall func(error)) error {
+	if interval <= 0 {
+		return invalidOption("non-positive snapshot interval %v", interval)
+	}
+	task := &snapshotTask{make(chan bool), make(chan bool)}
+	s.lockAll()
+	// Закрытие хранилища останавливает сохранение под той же блокировкой, поэтому после него задача не запускается
+	if s.IsClosed() {
+		s.unlockAll()
+		return ErrClosed
+	}
+	prev := s.snapshots
+	s.snapshots = task
+	s.unlockAll()
+	prev.stop()
+	ticker := s.Clock().NewTicker(interval)
+	go func() {
+		defer func() {
+			ticker.Stop()
+			close(task.doneChan)
+		}()
+		for {
+			select {
+			case <-ticker.C():
+				if err := s.SaveFile(path); err != nil && errorCall != nil {
+					errorCall(err)
+				}
+				clock.Ack(ticker)
+			case <-task.stopChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Остановка периодического сохранения снимков хранилища. Метод дожидается завершения выполняемого сохранения
+func (s *cache[K, V]) StopSnapshots() {
+	s.lockAll()
+	task := s.snapshots
+	s.snapshots = nil
+	s.unlockAll()
+	task.stop()
+}
+
+// Горутина периодического сохранения снимков
+type snapshotTask struct {
+	stopChan chan bool // Канал для остановки горутины
+	doneChan chan bool // Канал, закрываемый при завершении горутины
+}
+
+func (s *snapshotTask) stop() {
+	if s != nil {
+		close(s.stopChan)
+		<-s.doneChan
+	}
+}
@@ -0,0 +1,112 @@
+package containers
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Снимок статистики работы хранилища
+type CacheStats struct {
+	Hits         int64         // Количество успешных поисков объекта
+	Misses       int64         // Количество поисков, не нашедших объект
+	Loads        int64         // Количество вызовов методов создания и загрузки объектов
+	LoadErrors   int64         // Количество неудачных созданий и загрузок объектов
+	LoadDuration time.Duration // Суммарная длительность создания и загрузки объектов
+	Expirations  int64         // Количество объектов, удалённых клинером по истечении времени жизни
+	Deletes      int64         // Количество объектов, удалённых явно
+	Evictions    int64         // Количество объектов, вытесненных при превышении вместимости или стоимости
+}
+
+// Доля успешных поисков объекта
+func (s CacheStats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// Средняя длительность создания или загрузки объекта
+func (s CacheStats) AverageLoadDuration() time.Duration {
+	if s.Loads > 0 {
+		return s.LoadDuration / time.Duration(s.Loads)
+	}
+	return 0
+}
+
+// Счётчики статистики хранилища (изменяются атомарно, без блокировки хранилища).
+// Методы допускают вызов для nil, что соответствует хранилищу без сбора статистики
+type cacheStats struct {
+	hits, misses, loads, loadErrors, loadDuration, expirations, deletes, evictions int64
+}
+
+func (s *cacheStats) lookup(check bool) {
+	if s != nil {
+		if check {
+			atomic.AddInt64(&s.hits, 1)
+		} else {
+			atomic.AddInt64(&s.misses, 1)
+		}
+	}
+}
+
+func (s *cacheStats) load(start time.Time, check bool) {
+	if s != nil {
+		atomic.AddInt64(&s.loads, 1)
+		atomic.AddInt64(&s.loadDuration, int64(time.Since(start)))
+		if !check {
+			atomic.AddInt64(&s.loadErrors, 1)
+		}
+	}
+}
+
+func (s *cacheStats) expire(count int) {
+	if s != nil && count > 0 {
+		atomic.AddInt64(&s.expirations, int64(count))
+	}
+}
+
+func (s *cacheStats) delete() {
+	if s != nil {
+		atomic.AddInt64(&s.deletes, 1)
+	}
+}
+
+func (s *cacheStats) evict() {
+	if s != nil {
+		atomic.AddInt64(&s.evictions, 1)
+	}
+}
+
+func (s *cacheStats) snapshot() (res CacheStats) {
+	if s != nil {
+		res = CacheStats{
+			Hits:         atomic.LoadInt64(&s.hits),
+			Misses:       atomic.LoadInt64(&s.misses),
+			Loads:        atomic.LoadInt64(&s.loads),
+			LoadErrors:   atomic.LoadInt64(&s.loadErrors),
+			LoadDuration: time.Duration(atomic.LoadInt64(&s.loadDuration)),
+			Expirations:  atomic.LoadInt64(&s.expirations),
+			Deletes:      atomic.LoadInt64(&s.deletes),
+			Evictions:    atomic.LoadInt64(&s.evictions),
+		}
+	}
+	return
+}
+
+func (s *cacheStats) reset() {
+	if s != nil {
+		for _, counter := range []*int64{&s.hits, &s.misses, &s.loads, &s.loadErrors, &s.loadDuration, &s.expirations, &s.deletes, &s.evictions} {
+			atomic.StoreInt64(counter, 0)
+		}
+	}
+}
+
+// Возвращает снимок статистики работы хранилища
+func (s *cache[K, V]) Stats() CacheStats {
+	return s.stats.snapshot()
+}
+
+// Сброс счётчиков статистики хранилища
+func (s *cache[K, V]) ResetStats() {
+	s.stats.reset()
+}
@@ -0,0 +1,130 @@
+package containers
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Внешнее хранилище объектов второго уровня (см. TieredCache). Реализация должна допускать одновременный вызов
+// методов из нескольких горутин. Позволяет подключить, например, Redis без зависимости пакета от его клиента
+type Store = TypedStore[interface{}, interface{}]
+
+// Типизированный вариант Store
+type TypedStore[K comparable, V any] interface {
+	Get(key K) (value V, check bool, err error) // Поиск объекта (check == false при его отсутствии)
+	Set(key K, value V) error                   // Сохранение объекта
+	Delete(key K) error                         // Удаление объекта (отсутствие объекта ошибкой не является)
+}
+
+////////////////////////////////////////////////////////////////////////////
+
+// Конструктор хранилища объектов в памяти (используется в тестах вместо внешнего хранилища)
+func NewMemoryStore[K comparable, V any]() *MemoryStore[K, V] {
+	return &MemoryStore[K, V]{items: make(map[K]V)}
+}
+
+// Хранилище объектов в памяти
+type MemoryStore[K comparable, V any] struct {
+	locker sync.RWMutex
+	items  map[K]V
+}
+
+func (s *MemoryStore[K, V]) Get(key K) (value V, check bool, err error) {
+	s.locker.RLock()
+	value, check = s.items[key]
+	s.locker.RUnlock()
+	return
+}
+
+func (s *MemoryStore[K, V]) Set(key K, value V) error {
+	s.locker.Lock()
+	s.items[key] = value
+	s.locker.Unlock()
+	return nil
+}
+
+func (s *MemoryStore[K, V]) Delete(key K) error {
+	s.locker.Lock()
+	delete(s.items, key)
+	s.locker.Unlock()
+	return nil
+}
+
+// Возвращает количество объектов в хранилище
+func (s *MemoryStore[K, V]) Len() int {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+	return len(s.items)
+}
+
+////////////////////////////////////////////////////////////////////////////
+
+// Конструктор хранилища объектов в файлах каталога dir (каталог создаётся при отсутствии). Каждый объект хранится
+// в отдельном файле, имя которого формируется из ключа, и кодируется форматом codec (при codec == nil - GobCodec)
+func NewFileStore[V any](dir string, codec Codec) (*FileStore[V], error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if codec == nil {
+		codec = GobCodec
+	}
+	return &FileStore[V]{dir: dir, codec: codec}, nil
+}
+
+// Хранилище объектов в файлах каталога
+type FileStore[V any] struct {
+	dir   string
+	codec Codec
+}
+
+// Путь к файлу объекта. Ключ экранируется, поэтому не может указывать за пределы каталога
+func (s *FileStore[V]) path(key string) string {
+	return filepath.Join(s.dir, url.QueryEscape(key)+".cache")
+}
+
+func (s *FileStore[V]) Get(key string) (value V, check bool, err error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+	if err = s.codec.NewDecoder(f).Decode(&value); err == nil {
+		check = true
+	}
+	return
+}
+
+// Сохранение объекта. Объект записывается во временный файл, который затем переименовывается,
+// поэтому при сбое записи прежнее значение остаётся неповреждённым
+func (s *FileStore[V]) Set(key string, value V) error {
+	path := s.path(key)
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	err = s.codec.NewEncoder(tmp).Encode(value)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *FileStore[V]) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
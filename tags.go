@@ -0,0 +1,76 @@
+package containers
+
+import "time"
+
+// Индекс ключей объектов сегмента по тегам
+type tagIndex[K comparable] map[string]map[K]bool
+
+// Добавление ключа объекта в индекс по его тегам
+func (s *cacheShard[K, V]) tag(key K, item *cacheItem[V]) {
+	if len(item.tags) == 0 {
+		return
+	}
+	if s.tagged == nil {
+		s.tagged = make(tagIndex[K])
+	}
+	for _, tag := range item.tags {
+		keys, check := s.tagged[tag]
+		if !check {
+			keys = make(map[K]bool)
+			s.tagged[tag] = keys
+		}
+		keys[key] = true
+	}
+}
+
+// Удаление ключа объекта из индекса по его тегам
+func (s *cacheShard[K, V]) untag(key K, item *cacheItem[V]) {
+	for _, tag := range item.tags {
+		if keys, check := s.tagged[tag]; check {
+			if delete(keys, key); len(keys) == 0 {
+				delete(s.tagged, tag)
+			}
+		}
+	}
+}
+
+// Перенос тегов прежнего объекта old на объект, помещённый в сегмент при его фоновом обновлении
+func (s *cacheShard[K, V]) keepTags(key K, old *cacheItem[V]) {
+	if item, check := s.items[key]; check && item != old && len(item.tags) == 0 && len(old.tags) > 0 {
+		item.tags = old.tags
+		s.tag(key, item)
+	}
+}
+
+// Установка объекта по ключу с тегами. Все объекты с тегом удаляются методом InvalidateTag
+// (например, страницы, при формировании которых использовалась изменившаяся запись базы данных)
+func (s *cache[K, V]) SetWithTags(key K, value V, tags ...string) {
+	s.SetWithTagsAndTTL(key, value, s.expired, tags...)
+}
+
+// Установка объекта по ключу с тегами и собственным временем жизни (см. SetWithTTL)
+func (s *cache[K, V]) SetWithTagsAndTTL(key K, value V, ttl time.Duration, tags ...string) {
+	shard := s.shard(key)
+	shard.locker.Lock()
+	exp := shard.expiration(ttl)
+	expire, deadline := exp.deadlines(shard.clock.Now())
+	shard.putItem(key, &cacheItem[V]{value, expire, exp.TTL, exp.Mode, deadline, shard.itemCost(key, value), append([]string(nil), tags...)})
+	shard.unlock()
+}
+
+// Удаление всех объектов с тегом tag. Удаление выполняется при блокировке всех сегментов, поэтому другие горутины
+// не могут получить часть удаляемых объектов. Удалённые объекты передаются в метод OnEvict с причиной EVICT_INVALIDATED.
+// Возвращает количество удалённых объектов
+func (s *cache[K, V]) InvalidateTag(tag string) (res int) {
+	s.lockAll()
+	for _, shard := range s.shards {
+		for key := range shard.tagged[tag] {
+			shard.policyRemove(key)
+			shard.removeItem(key, shard.items[key], EVICT_INVALIDATED)
+			s.stats.delete()
+			res++
+		}
+	}
+	s.unlockAll()
+	return
+}
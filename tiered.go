@@ -0,0 +1,253 @@
+package containers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Режим записи объектов двухуровневого кэша во внешнее хранилище
+type StoreMode byte
+
+const (
+	STORE_READ_THROUGH  StoreMode = iota // Объекты только читаются из хранилища, запись выполняется в кэш первого уровня
+	STORE_WRITE_THROUGH                  // Объекты записываются в хранилище синхронно при помещении в кэш
+	STORE_WRITE_BEHIND                   // Объекты записываются в хранилище в фоновом режиме через очередь отложенной записи
+)
+
+func (s StoreMode) String() string {
+	switch s {
+	case STORE_READ_THROUGH:
+		return "STORE_READ_THROUGH"
+	case STORE_WRITE_THROUGH:
+		return "STORE_WRITE_THROUGH"
+	case STORE_WRITE_BEHIND:
+		return "STORE_WRITE_BEHIND"
+	default:
+		return "STORE_UNDEFINED"
+	}
+}
+
+// Пакетная запись в хранилище, не реализующее TypedWriter: операции пакета выполняются по одной
+type storeWriter[K comparable, V any] struct {
+	store TypedStore[K, V]
+}
+
+func (s storeWriter[K, V]) Write(batch []WriteOp[K, V]) (err error) {
+	for _, op := range batch {
+		if op.Delete {
+			err = s.store.Delete(op.Key)
+		} else {
+			err = s.store.Set(op.Key, op.Value)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Возвращает получатель отложенной записи в хранилище store (само хранилище, если оно поддерживает пакетную запись)
+func storeWriterOf[K comparable, V any](store TypedStore[K, V]) TypedWriter[K, V] {
+	if writer, check := store.(TypedWriter[K, V]); check {
+		return writer
+	}
+	return storeWriter[K, V]{store}
+}
+
+// Конструктор двухуровневого кэша: кэш в памяти (создаётся с параметрами opts, см. NewTyped) перед внешним
+// хранилищем store. Объекты, отсутствующие в кэше, ищутся в хранилище и только затем создаются методом
+// загрузки. В режиме STORE_WRITE_BEHIND изменения записываются в хранилище с интервалом flushInterval
+// (для управления размером пакетов и повторными попытками см. NewWriteBehindCache).
+// Ошибки хранилища, которые не могут быть возвращены вызывающей стороне, передаются в errorCall (при его наличии)
+func NewTieredCache[K comparable, V any](store TypedStore[K, V], mode StoreMode, flushInterval time.Duration, errorCall func(error), opts ...Option) (*TieredCache[K, V], error) {
+	if store == nil {
+		return nil, invalidOption("tiered cache requires store")
+	}
+	if mode == STORE_WRITE_BEHIND {
+		if flushInterval <= 0 {
+			return nil, invalidOption("write-behind mode requires flush interval")
+		}
+		return NewWriteBehindCache(store, nil, WriteBehindConfig{Interval: flushInterval, ErrorCall: errorCall}, opts...)
+	}
+	l1, err := NewTyped[K, V](opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TieredCache[K, V]{l1: l1, store: store, mode: mode, errorCall: errorCall}, nil
+}
+
+// Конструктор кэша с отложенной записью: изменения, выполненные методами Set и Delete, подтверждаются сразу
+// и передаются в writer пакетами согласно config (см. NewWriteBehindQueue), оставшиеся изменения записываются
+// при закрытии кэша. Если store != nil, объекты, отсутствующие в кэше, ищутся в нём (см. NewTieredCache),
+// а при writer == nil изменения записываются в store. Если часы config не заданы, используются часы кэша
+func NewWriteBehindCache[K comparable, V any](store TypedStore[K, V], writer TypedWriter[K, V], config WriteBehindConfig, opts ...Option) (*TieredCache[K, V], error) {
+	if writer == nil {
+		if store == nil {
+			return nil, invalidOption("write-behind cache requires writer or store")
+		}
+		writer = storeWriterOf(store)
+	}
+	l1, err := NewTyped[K, V](opts...)
+	if err != nil {
+		return nil, err
+	}
+	if config.Clock == nil {
+		config.Clock = l1.Clock()
+	}
+	queue, err := NewWriteBehindQueue(writer, config)
+	if err != nil {
+		l1.Close()
+		return nil, err
+	}
+	return &TieredCache[K, V]{l1: l1, store: store, mode: STORE_WRITE_BEHIND, errorCall: config.ErrorCall, queue: queue}, nil
+}
+
+// Двухуровневый кэш
+type TieredCache[K comparable, V any] struct {
+	l1        *TypedCache[K, V]       // Кэш первого уровня
+	store     TypedStore[K, V]        // Внешнее хранилище (второй уровень, может отсутствовать в режиме STORE_WRITE_BEHIND)
+	mode      StoreMode               // Режим записи во внешнее хранилище
+	errorCall func(error)             // Метод обработки ошибок хранилища
+	queue     *WriteBehindQueue[K, V] // Очередь отложенной записи (в режиме STORE_WRITE_BEHIND)
+	closeOnce sync.Once
+}
+
+// Возвращает кэш первого уровня. Операции с ним не затрагивают внешнее хранилище
+func (s *TieredCache[K, V]) Cache() *TypedCache[K, V] {
+	return s.l1
+}
+
+func (s *TieredCache[K, V]) reportError(err error) {
+	if err != nil && s.errorCall != nil {
+		s.errorCall(err)
+	}
+}
+
+// Поиск объекта во внешнем хранилище с учётом ещё не записанных в него изменений
+func (s *TieredCache[K, V]) fromStore(key K) (value V, check bool, err error) {
+	if s.queue != nil {
+		if op, exists := s.queue.Get(key); exists {
+			return op.Value, !op.Delete, nil
+		}
+	}
+	if s.store == nil {
+		return
+	}
+	return s.store.Get(key)
+}
+
+// Запись изменения во внешнее хранилище согласно режиму кэша
+func (s *TieredCache[K, V]) write(op WriteOp[K, V]) error {
+	switch s.mode {
+	case STORE_WRITE_THROUGH:
+		if op.Delete {
+			return s.store.Delete(op.Key)
+		}
+		return s.store.Set(op.Key, op.Value)
+	case STORE_WRITE_BEHIND:
+		return s.queue.Enqueue(op)
+	}
+	return nil
+}
+
+// Поиск объекта по ключу. Объект, отсутствующий в кэше первого уровня, ищется во внешнем хранилище
+// и при обнаружении помещается в кэш
+func (s *TieredCache[K, V]) Get(key K, cCall TypedCheckMethod[V]) (V, bool) {
+	if res, check := s.l1.Get(key, cCall); check {
+		return res, true
+	}
+	res, check, err := s.fromStore(key)
+	if s.reportError(err); !check || (cCall != nil && !cCall(res)) {
+		var empty V
+		return empty, false
+	}
+	s.l1.Set(key, res)
+	return res, true
+}
+
+// Установка объекта по ключу. В режиме STORE_WRITE_THROUGH возвращает ошибку записи во внешнее хранилище,
+// в режиме STORE_WRITE_BEHIND - ErrClosed после закрытия кэша
+func (s *TieredCache[K, V]) Set(key K, value V) error {
+	s.l1.Set(key, value)
+	return s.write(WriteOp[K, V]{Key: key, Value: value})
+}
+
+// Удаление объекта по ключу из кэша и (кроме режима STORE_READ_THROUGH) из внешнего хранилища
+func (s *TieredCache[K, V]) Delete(key K) error {
+	s.l1.Delete(key)
+	return s.write(WriteOp[K, V]{Key: key, Delete: true})
+}
+
+// Поиск объекта по ключу с созданием при его отсутствии (см. Cache.GetOrCreate). Объект, отсутствующий в кэше
+// первого уровня, ищется во внешнем хранилище, createCall вызывается только при его отсутствии и там.
+// Созданный объект записывается во внешнее хранилище согласно режиму кэша. Поиск во внешнем хранилище и создание
+// выполняются как загрузка (см. Cache.Load): кэш первого уровня не блокируется, а горутины, одновременно запросившие
+// отсутствующий ключ, получают результат единственного вызова. Если createCall создаёт объект с другим ключом,
+// объект получает только вызвавшая его горутина
+func (s *TieredCache[K, V]) GetOrCreate(key K, cCall TypedCheckMethod[V], createCall TypedCreateMethod[K, V]) (V, bool) {
+	var moved bool // Объект создан с другим ключом
+	res, err := s.l1.Load(key, cCall, func(key K) (V, error) {
+		res, check, err := s.fromStore(key)
+		if s.reportError(err); check && (cCall == nil || cCall(res)) {
+			return res, nil
+		}
+		rKey, res, check := createCall(key)
+		if !check {
+			return res, errNotCreated
+		}
+		s.reportError(s.write(WriteOp[K, V]{Key: rKey, Value: res}))
+		if rKey != key {
+			s.l1.Set(rKey, res)
+			moved = true
+			return res, errNotCreated
+		}
+		return res, nil
+	})
+	return res, err == nil || moved
+}
+
+// Поиск объекта по ключу с загрузкой при его отсутствии (см. Cache.GetOrLoad). Объект, отсутствующий в кэше
+// первого уровня, ищется во внешнем хранилище, loader вызывается только при его отсутствии и там.
+// При loader == nil используется загрузчик по умолчанию кэша первого уровня (WithLoader), при его отсутствии
+// для объекта, не найденного во внешнем хранилище, возвращается ErrNoLoader
+func (s *TieredCache[K, V]) GetOrLoad(ctx context.Context, key K, loader TypedContextLoadMethod[K, V]) (V, error) {
+	if loader == nil {
+		loader = s.l1.loader
+	}
+	return s.l1.GetOrLoad(ctx, key, func(ctx context.Context, key K) (V, error) {
+		res, check, err := s.fromStore(key)
+		if err != nil || check {
+			return res, err
+		}
+		if loader == nil {
+			return res, ErrNoLoader
+		}
+		if res, err = loader(ctx, key); err == nil {
+			s.reportError(s.write(WriteOp[K, V]{Key: key, Value: res}))
+		}
+		return res, err
+	})
+}
+
+// Запись отложенных изменений во внешнее хранилище (в режиме STORE_WRITE_BEHIND, см. WriteBehindQueue.Flush).
+// Изменения, которые не удалось записать, остаются в очереди до следующей записи
+func (s *TieredCache[K, V]) Flush() error {
+	if s.queue == nil {
+		return nil
+	}
+	return s.queue.Flush()
+}
+
+// Закрытие кэша: остановка фоновой записи с записью оставшихся изменений во внешнее хранилище и закрытие кэша
+// первого уровня. Возвращает ошибку записи изменений или ErrClosed при повторном вызове
+func (s *TieredCache[K, V]) Close() error {
+	err := ErrClosed
+	s.closeOnce.Do(func() {
+		if err = nil; s.queue != nil {
+			err = s.queue.Close()
+		}
+		s.l1.Close()
+	})
+	return err
+}
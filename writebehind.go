@@ -0,0 +1,277 @@
+package containers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fcg-xvii/containers/clock"
+)
+
+// Операция отложенной записи
+type WriteOp[K comparable, V any] struct {
+	Key    K
+	Value  V
+	Delete bool // Объект удаляется (Value не используется)
+}
+
+// Получатель пакетов отложенной записи (например, база данных или внешнее хранилище)
+type Writer = TypedWriter[interface{}, interface{}]
+
+// Типизированный вариант Writer
+type TypedWriter[K comparable, V any] interface {
+	Write(batch []WriteOp[K, V]) error
+}
+
+// Метод, реализующий TypedWriter
+type TypedWriterFunc[K comparable, V any] func(batch []WriteOp[K, V]) error
+
+func (s TypedWriterFunc[K, V]) Write(batch []WriteOp[K, V]) error { return s(batch) }
+
+// Параметры очереди отложенной записи
+type WriteBehindConfig struct {
+	BatchSize  int           // Максимальный размер пакета. Накопление BatchSize операций запускает запись (0 - без ограничения)
+	Interval   time.Duration // Интервал периодической записи (0 - запись только по размеру пакета и при закрытии)
+	Retries    int           // Количество повторных попыток записи пакета при ошибке
+	RetryDelay time.Duration // Задержка перед первой повторной попыткой (удваивается с каждой следующей)
+	ErrorCall  func(error)   // Метод обработки ошибок фоновой записи
+	Clock      clock.Clock   // Источник времени для интервала записи и задержек повторных попыток (по умолчанию системные часы)
+}
+
+// Конструктор очереди отложенной записи. Операции, помещённые в очередь, подтверждаются сразу и передаются
+// в writer пакетами по достижении размера пакета или по истечении интервала. Несколько операций с одним ключом,
+// ожидающих записи, объединяются в последнюю из них
+func NewWriteBehindQueue[K comparable, V any](writer TypedWriter[K, V], config WriteBehindConfig) (*WriteBehindQueue[K, V], error) {
+	switch {
+	case config.BatchSize < 0 || config.Interval < 0 || config.Retries < 0 || config.RetryDelay < 0:
+		return nil, invalidOption("negative write-behind parameter")
+	case config.BatchSize == 0 && config.Interval == 0:
+		return nil, invalidOption("write-behind queue requires batch size or interval")
+	}
+	if config.Clock == nil {
+		config.Clock = clock.System
+	}
+	res := &WriteBehindQueue[K, V]{
+		WriteBehindConfig: config,
+		writer:            writer,
+		pending:           make(map[K]WriteOp[K, V]),
+		flushChan:         make(chan bool, 1),
+		stopChan:          make(chan bool),
+		doneChan:          make(chan bool),
+	}
+	var ticker clock.Ticker
+	if config.Interval > 0 {
+		ticker = config.Clock.NewTicker(config.Interval)
+	}
+	go res.run(ticker)
+	return res, nil
+}
+
+// Очередь отложенной записи
+type WriteBehindQueue[K comparable, V any] struct {
+	WriteBehindConfig
+	writer      TypedWriter[K, V]
+	locker      sync.Mutex
+	flushLocker sync.Mutex          // Исключает одновременную запись пакетов
+	pending     map[K]WriteOp[K, V] // Операции, ожидающие записи
+	order       []K                 // Порядок поступления ключей операций, ожидающих записи
+	inflight    map[K]WriteOp[K, V] // Операции, записываемые в данный момент
+	closed      bool
+	flushChan   chan bool // Канал запуска записи при достижении размера пакета
+	stopChan    chan bool // Канал для остановки горутины записи
+	doneChan    chan bool // Канал, закрываемый при завершении горутины записи
+}
+
+// Помещение операции в очередь. Возвращает ErrClosed для закрытой очереди
+func (s *WriteBehindQueue[K, V]) Enqueue(op WriteOp[K, V]) error {
+	s.locker.Lock()
+	if s.closed {
+		s.locker.Unlock()
+		return ErrClosed
+	}
+	if _, check := s.pending[op.Key]; !check {
+		s.order = append(s.order, op.Key)
+	}
+	s.pending[op.Key] = op
+	full := s.BatchSize > 0 && len(s.pending) >= s.BatchSize
+	s.locker.Unlock()
+	if full {
+		select {
+		case s.flushChan <- true:
+		default:
+		}
+	}
+	return nil
+}
+
+// Помещение в очередь записи объекта
+func (s *WriteBehindQueue[K, V]) Set(key K, value V) error {
+	return s.Enqueue(WriteOp[K, V]{Key: key, Value: value})
+}
+
+// Помещение в очередь удаления объекта
+func (s *WriteBehindQueue[K, V]) Delete(key K) error {
+	return s.Enqueue(WriteOp[K, V]{Key: key, Delete: true})
+}
+
+// Поиск последней ещё не записанной операции с ключом key (в том числе записываемой в данный момент)
+func (s *WriteBehindQueue[K, V]) Get(key K) (op WriteOp[K, V], check bool) {
+	s.locker.Lock()
+	if op, check = s.pending[key]; !check {
+		op, check = s.inflight[key]
+	}
+	s.locker.Unlock()
+	return
+}
+
+// Возвращает количество операций, ожидающих записи
+func (s *WriteBehindQueue[K, V]) Len() int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return len(s.pending)
+}
+
+// Запись пакета с повторными попытками при ошибке (параметры ожидания см. в wait)
+func (s *WriteBehindQueue[K, V]) write(batch []WriteOp[K, V], ticker clock.Ticker, ack func()) (err error) {
+	delay := s.RetryDelay
+	for attempt := 0; ; attempt++ {
+		if err = s.writer.Write(batch); err == nil || attempt >= s.Retries {
+			return
+		}
+		if delay > 0 {
+			s.wait(delay, ticker, ack)
+			delay *= 2
+		}
+	}
+}
+
+// Ожидание в течение d по часам очереди (прерывается закрытием очереди). При вызове из горутины фоновой записи
+// перед ожиданием вызывается ack, подтверждающий сигнал тикера ticker, запустивший запись, а сигналы, поступающие
+// во время ожидания, подтверждаются без выполнения записи. Иначе тестовые часы, дожидающиеся подтверждения
+// сигнала, не смогли бы отсчитать задержку
+func (s *WriteBehindQueue[K, V]) wait(d time.Duration, ticker clock.Ticker, ack func()) {
+	timer := s.Clock.NewTicker(d)
+	defer timer.Stop()
+	if ack != nil {
+		ack()
+	}
+	var tick <-chan time.Time
+	if ticker != nil {
+		tick = ticker.C()
+	}
+	for {
+		select {
+		case <-timer.C():
+			return
+		case <-tick:
+			clock.Ack(ticker)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Запись всех операций, ожидающих записи. При ошибке записи пакета (после всех повторных попыток) запись
+// прекращается, а незаписанные операции, не заменённые за это время новыми, возвращаются в начало очереди.
+// Повторные попытки выполняются с задержкой, поэтому при ошибках записи метод может выполняться
+// до RetryDelay * (2^Retries - 1) на каждый пакет. После закрытия очереди повторные попытки выполняются без задержки
+func (s *WriteBehindQueue[K, V]) Flush() error {
+	return s.flush(nil, nil)
+}
+
+// Реализация Flush. Горутина фоновой записи передаёт свой тикер и метод подтверждения его сигнала (см. wait)
+func (s *WriteBehindQueue[K, V]) flush(ticker clock.Ticker, ack func()) (err error) {
+	if !s.flushLocker.TryLock() {
+		// Выполняется запись, запущенная Flush, сигнал тикера подтверждается без ожидания её завершения
+		if ack != nil {
+			ack()
+		}
+		s.flushLocker.Lock()
+	}
+	defer s.flushLocker.Unlock()
+	s.locker.Lock()
+	order, pending := s.order, s.pending
+	s.order, s.pending, s.inflight = nil, make(map[K]WriteOp[K, V]), pending
+	s.locker.Unlock()
+	for len(order) > 0 {
+		size := len(order)
+		if s.BatchSize > 0 && size > s.BatchSize {
+			size = s.BatchSize
+		}
+		batch := make([]WriteOp[K, V], size)
+		for i, key := range order[:size] {
+			batch[i] = pending[key]
+		}
+		if err = s.write(batch, ticker, ack); err != nil {
+			break
+		}
+		s.locker.Lock()
+		for _, key := range order[:size] {
+			delete(s.inflight, key)
+		}
+		s.locker.Unlock()
+		order = order[size:]
+	}
+	s.locker.Lock()
+	if err != nil {
+		var back []K
+		for _, key := range order {
+			if _, check := s.pending[key]; !check {
+				s.pending[key] = pending[key]
+				back = append(back, key)
+			}
+		}
+		s.order = append(back, s.order...)
+	}
+	s.inflight = nil
+	s.locker.Unlock()
+	return
+}
+
+// Горутина фоновой записи
+func (s *WriteBehindQueue[K, V]) run(ticker clock.Ticker) {
+	var tick <-chan time.Time
+	if ticker != nil {
+		tick = ticker.C()
+		defer ticker.Stop()
+	}
+	defer close(s.doneChan)
+	for {
+		select {
+		case <-tick:
+			acked := false
+			ack := func() {
+				if !acked {
+					acked = true
+					clock.Ack(ticker)
+				}
+			}
+			s.reportError(s.flush(ticker, ack))
+			ack()
+		case <-s.flushChan:
+			s.reportError(s.flush(ticker, nil))
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *WriteBehindQueue[K, V]) reportError(err error) {
+	if err != nil && s.ErrorCall != nil {
+		s.ErrorCall(err)
+	}
+}
+
+// Закрытие очереди с записью всех ожидающих операций. Ожидание задержки повторной попытки прерывается,
+// оставшиеся попытки выполняются без задержки (см. Flush). Возвращает ошибку записи или ErrClosed при повторном вызове
+func (s *WriteBehindQueue[K, V]) Close() error {
+	s.locker.Lock()
+	if s.closed {
+		s.locker.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	s.locker.Unlock()
+	close(s.stopChan)
+	<-s.doneChan
+	return s.Flush()
+}
@@ -1,11 +1,21 @@
 package containers
 
 import (
-	_ "fmt"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/fcg-xvii/containers/clock/clocktest"
 )
 
 type cacheStruct struct {
@@ -15,7 +25,7 @@ type cacheStruct struct {
 
 func init() {
 	cacher.clearPrepare = func(items []interface{}) {
-		log.Println(items, cacher.items)
+		log.Println(items, cacher.Keys())
 	}
 }
 
@@ -101,6 +111,1162 @@ func TestCache(t *testing.T) {
 	log.Println(cacher.Get("ok", nil))
 }
 
+func TestTypedCache(t *testing.T) {
+	tCacher := NewTypedCache[int, string](time.Second*10, time.Second*15, nil)
+	val, check := tCacher.GetOrCreate(10, func(val string) bool {
+		return len(val) > 0
+	}, func(key int) (int, string, bool) {
+		return key, "ten", true
+	})
+	if !check || val != "ten" {
+		t.Fatal("unexpected value", val, check)
+	}
+	if val, check = tCacher.Get(10, nil); !check || val != "ten" {
+		t.Fatal("unexpected value", val, check)
+	}
+	tCacher.Delete(10)
+	if _, check = tCacher.Get(10, nil); check {
+		t.Fatal("item must be deleted")
+	}
+	t.Log(tCacher.Keys(), tCacher.Len())
+}
+
+func TestLRUCache(t *testing.T) {
+	var evicted []string
+	lru := NewTypedLRUCache[int, string](time.Second*10, time.Second*15, 2, func(items []string) {
+		evicted = append(evicted, items...)
+	})
+	lru.Set(1, "one")
+	lru.Set(2, "two")
+	lru.Get(1, nil)
+	lru.Set(3, "three")
+	if lru.Len() != 2 {
+		t.Fatal("expected 2 items, found", lru.Len())
+	}
+	if _, check := lru.Get(2, nil); check {
+		t.Fatal("least recently used item must be evicted")
+	}
+	if len(evicted) != 1 || evicted[0] != "two" {
+		t.Fatal("unexpected evicted items", evicted)
+	}
+	t.Log(lru.Keys())
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	policies := map[string]PolicyConstructor[int]{
+		"LRU":  NewLRUPolicy[int],
+		"LFU":  NewLFUPolicy[int],
+		"FIFO": NewFIFOPolicy[int],
+		"ARC":  NewARCPolicy[int],
+		"2Q":   New2QPolicy[int],
+	}
+	for name, policy := range policies {
+		c := NewTypedPolicyCache[int, int](time.Second*10, time.Second*15, 8, policy, nil)
+		for i := 0; i < 100; i++ {
+			c.Set(i%20, i)
+			c.Get(i%3, nil)
+		}
+		if c.Len() != 8 {
+			t.Fatal(name, "expected 8 items, found", c.Len())
+		}
+		t.Log(name, c.Keys())
+	}
+}
+
+func TestWeightedCache(t *testing.T) {
+	var evicted []string
+	c := NewTypedWeightedCache[int, string](time.Second*10, time.Second*15, 10, func(key int, val string) int64 {
+		return int64(len(val))
+	}, nil, func(items []string) {
+		evicted = append(evicted, items...)
+	})
+	c.Set(1, "aaaa")
+	c.Set(2, "bbbb")
+	if c.Cost() != 8 {
+		t.Fatal("expected cost 8, found", c.Cost())
+	}
+	c.SetWithCost(3, "c", 5)
+	if c.Cost() != 9 || c.Len() != 2 {
+		t.Fatal("unexpected cost or length", c.Cost(), c.Len())
+	}
+	if len(evicted) != 1 || evicted[0] != "aaaa" {
+		t.Fatal("unexpected evicted items", evicted)
+	}
+	val, check := c.GetOrCreateWithCost(4, nil, func(key int) (int, string, int64, bool) {
+		return key, "d", 1, true
+	})
+	t.Log(val, check, c.Keys(), c.Cost())
+}
+
+// Политики ARC и 2Q в хранилище, ограниченном только стоимостью, ориентируются на количество объектов, а не на стоимость
+func TestWeightedPolicies(t *testing.T) {
+	weigher := func(key int, val int) int64 { return 1024 }
+	for name, policy := range map[string]PolicyConstructor[int]{"ARC": NewARCPolicy[int], "2Q": New2QPolicy[int]} {
+		c := NewTypedWeightedCache[int, int](time.Second*10, time.Second*15, 4096, weigher, policy, nil)
+		c.Set(0, 0)
+		c.Get(0, nil)
+		for i := 1; i <= 4; i++ {
+			c.Set(i, i)
+		}
+		c.Set(0, 0)
+		c.Get(0, nil)
+		// Однократное сканирование не вытесняет часто используемый объект
+		for i := 5; i <= 7; i++ {
+			c.Set(i, i)
+		}
+		if _, check := c.Get(0, nil); !check || c.Len() != 4 {
+			t.Fatal(name, "hot item must survive scan", c.Keys())
+		}
+		for i := 0; i < 10000; i++ {
+			c.Set(i, i)
+		}
+		if arc, check := c.shards[0].evictor.(*arcPolicy[int]); check && arc.b1.Len()+arc.b2.Len() > 2*c.Len() {
+			t.Fatal(name, "ghost keys must be limited by item count", arc.b1.Len(), arc.b2.Len())
+		}
+		if q, check := c.shards[0].evictor.(*twoQueuePolicy[int]); check && q.a1out.Len() > c.Len() {
+			t.Fatal(name, "ghost keys must be limited by item count", q.a1out.Len())
+		}
+	}
+}
+
+func TestCacheItemTTL(t *testing.T) {
+	c := NewTypedCache[string, string](time.Millisecond*10, time.Hour, nil)
+	c.Set("default", "default")
+	c.SetWithTTL("short", "short", time.Millisecond*30)
+	c.GetOrCreateWithTTL("token", nil, func(key string) (string, string, time.Duration, bool) {
+		return key, "token", time.Millisecond * 30, true
+	})
+	time.Sleep(time.Millisecond * 100)
+	if _, check := c.Get("short", nil); check {
+		t.Fatal("item with short ttl must be removed")
+	}
+	if _, check := c.Get("token", nil); check {
+		t.Fatal("created item with short ttl must be removed")
+	}
+	if _, check := c.Get("default", nil); !check {
+		t.Fatal("item with default ttl must be kept")
+	}
+}
+
+func TestCacheExpirationMode(t *testing.T) {
+	c := NewTypedCache[string, int](time.Millisecond*5, time.Millisecond*40, nil)
+	c.Set("sliding", 1)
+	c.SetWithExpiration("absolute", 2, Expiration{TTL: time.Millisecond * 40, Mode: EXPIRE_ABSOLUTE})
+	c.SetWithExpiration("max-age", 3, Expiration{TTL: time.Millisecond * 40, Mode: EXPIRE_SLIDING_MAX_AGE, MaxAge: time.Millisecond * 60})
+	for i := 0; i < 10; i++ {
+		time.Sleep(time.Millisecond * 10)
+		c.Get("sliding", nil)
+		c.Get("absolute", nil)
+		c.Get("max-age", nil)
+	}
+	if _, check := c.Get("sliding", nil); !check {
+		t.Fatal("sliding item must be kept")
+	}
+	if _, check := c.Get("absolute", nil); check {
+		t.Fatal("absolute item must be removed")
+	}
+	if _, check := c.Get("max-age", nil); check {
+		t.Fatal("item must be removed after max age")
+	}
+}
+
+func TestCacheLoad(t *testing.T) {
+	c := NewTypedCache[int, string](time.Second*10, time.Second*15, nil)
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := c.Load(1, nil, func(key int) (string, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(time.Millisecond * 50)
+				return "one", nil
+			})
+			if err != nil || val != "one" {
+				t.Error("unexpected load result", val, err)
+			}
+		}()
+	}
+	// Другие ключи доступны во время загрузки
+	time.Sleep(time.Millisecond * 10)
+	c.Set(2, "two")
+	if _, check := c.Get(2, nil); !check {
+		t.Fatal("item must be available during load")
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatal("expected single loader call, found", calls)
+	}
+	if _, err := c.Load(3, nil, func(key int) (string, error) {
+		return "", errors.New("load error")
+	}); err == nil {
+		t.Fatal("loader error expected")
+	}
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	c := NewTypedCache[int, string](time.Second*10, time.Second*15, nil)
+	c.SetErrorTTL(time.Second)
+	var calls int32
+	loader := func(ctx context.Context, key int) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 50)
+		if key < 0 {
+			return "", errors.New("negative key")
+		}
+		return "value", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := c.GetOrLoad(ctx, 1, loader); err != context.DeadlineExceeded {
+		t.Fatal("expected deadline error, found", err)
+	}
+	if val, err := c.GetOrLoad(context.Background(), 1, loader); err != nil || val != "value" {
+		t.Fatal("unexpected load result", val, err)
+	}
+	if calls != 1 {
+		t.Fatal("expected single loader call, found", calls)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetOrLoad(context.Background(), -1, loader); err == nil {
+			t.Fatal("loader error expected")
+		}
+	}
+	if calls != 2 {
+		t.Fatal("loader error must be cached, loader calls", calls)
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	c := NewTypedShardedCache[int, int](8, time.Second*10, time.Second*15, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Set(offset*100+j, j)
+				c.Get(offset*100+j, nil)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if c.Len() != 800 || len(c.Keys()) != 800 {
+		t.Fatal("expected 800 items, found", c.Len())
+	}
+	val, check := c.Each(0, func(val int) bool { return val == 99 }, nil)
+	if !check || val != 99 {
+		t.Fatal("unexpected each result", val, check)
+	}
+	c.Delete(1)
+	if _, check = c.Get(1, nil); check {
+		t.Fatal("item must be deleted")
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	c := NewTypedLRUCache[int, int](time.Millisecond*5, time.Millisecond*20, 2, nil)
+	c.Set(1, 1)
+	c.Get(1, nil)
+	c.Get(2, nil)
+	c.GetOrCreate(2, nil, func(key int) (int, int, bool) { return key, key, true })
+	c.GetOrCreate(3, nil, func(key int) (int, int, bool) { return key, key, false })
+	c.Set(4, 4)
+	c.Delete(4)
+	time.Sleep(time.Millisecond * 50)
+	stats := c.Stats()
+	t.Logf("%+v, hit ratio %v", stats, stats.HitRatio())
+	if stats.Hits != 1 || stats.Misses != 3 || stats.Loads != 2 || stats.LoadErrors != 1 {
+		t.Fatal("unexpected lookup stats", stats)
+	}
+	if stats.Deletes != 1 || stats.Evictions != 1 || stats.Expirations != 1 {
+		t.Fatal("unexpected removal stats", stats)
+	}
+	c.ResetStats()
+	if c.Stats() != (CacheStats{}) {
+		t.Fatal("stats must be reset")
+	}
+}
+
+func TestCacheOnEvict(t *testing.T) {
+	c := NewTypedLRUCache[int, string](time.Millisecond*5, time.Millisecond*20, 2, nil)
+	var locker sync.Mutex
+	reasons := make(map[EvictReason][]int)
+	c.OnEvict(func(key int, value string, reason EvictReason) {
+		locker.Lock()
+		reasons[reason] = append(reasons[reason], key)
+		locker.Unlock()
+	})
+	c.Set(1, "one")
+	c.Set(1, "one again")
+	c.Set(2, "two")
+	c.Set(3, "three")
+	c.Delete(2)
+	time.Sleep(time.Millisecond * 50)
+	c.Set(4, "four")
+	c.Clear()
+	locker.Lock()
+	defer locker.Unlock()
+	t.Log(reasons)
+	for reason, keys := range map[EvictReason][]int{
+		EVICT_REPLACED: {1},
+		EVICT_CAPACITY: {1},
+		EVICT_DELETED:  {2},
+		EVICT_EXPIRED:  {3},
+		EVICT_CLEARED:  {4},
+	} {
+		if len(reasons[reason]) != 1 || reasons[reason][0] != keys[0] {
+			t.Fatal("unexpected evicted keys", reason, reasons[reason])
+		}
+	}
+	if c.Len() != 0 {
+		t.Fatal("cache must be empty after clear")
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	c := NewTypedCache[string, int](time.Second*10, time.Minute, nil)
+	c.Set("default", 1)
+	c.SetWithTTL("forever", 2, 0)
+	c.SetWithTTL("short", 3, time.Millisecond*10)
+	var buf bytes.Buffer
+	if err := c.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	restored := NewTypedCache[string, int](time.Second*10, time.Minute, nil)
+	if err := restored.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != 2 {
+		t.Fatal("expected 2 restored items, found", restored.Keys())
+	}
+	if val, check := restored.Get("forever", nil); !check || val != 2 {
+		t.Fatal("unexpected restored value", val, check)
+	}
+
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c.SetCodec(JSONCodec)
+	if err := c.StartSnapshots(path, 0, nil); !errors.Is(err, ErrInvalidOption) {
+		t.Fatal("expected ErrInvalidOption, found", err)
+	}
+	if err := c.StartSnapshots(path, time.Millisecond*10, func(err error) { t.Error(err) }); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	c.StopSnapshots()
+	fromFile := NewTypedCache[string, int](time.Second*10, time.Minute, nil)
+	fromFile.SetCodec(JSONCodec)
+	if err := fromFile.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(fromFile.Keys())
+	if fromFile.Len() != 2 {
+		t.Fatal("expected 2 items loaded from file, found", fromFile.Keys())
+	}
+	fromFile.Close()
+	if err := fromFile.StartSnapshots(path, time.Millisecond*10, nil); err != ErrClosed {
+		t.Fatal("expected ErrClosed, found", err)
+	}
+}
+
+func TestCacheClose(t *testing.T) {
+	c := NewTypedShardedCache[int, int](4, time.Millisecond, time.Minute, nil)
+	var flushed int32
+	c.OnEvict(func(key, value int, reason EvictReason) {
+		if reason == EVICT_CLOSED {
+			atomic.AddInt32(&flushed, 1)
+		}
+	})
+	for i := 0; i < 10; i++ {
+		c.Set(i, i)
+	}
+	if err := c.CloseAndFlush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != ErrClosed {
+		t.Fatal("expected ErrClosed, found", err)
+	}
+	if flushed != 10 {
+		t.Fatal("expected 10 flushed items, found", flushed)
+	}
+	c.Set(1, 1)
+	if _, check := c.Get(1, nil); check || c.Len() != 0 {
+		t.Fatal("closed cache must not store items")
+	}
+	if _, err := c.Load(1, nil, func(key int) (int, error) { return key, nil }); err != ErrClosed {
+		t.Fatal("expected ErrClosed, found", err)
+	}
+
+	// Закрытие из метода OnEvict, вызванного клинером
+	c = NewTypedCache[int, int](time.Millisecond, time.Hour, nil)
+	closed := make(chan error, 1)
+	c.OnEvict(func(key, value int, reason EvictReason) {
+		if reason == EVICT_EXPIRED {
+			closed <- c.Close()
+		}
+	})
+	c.SetWithTTL(1, 1, time.Millisecond)
+	c.Set(2, 2)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close from OnEvict must not deadlock")
+	}
+
+	// Закрытие из другой горутины дожидается завершения клинера, выполняющего медленный метод OnEvict
+	c = NewTypedCache[int, int](time.Millisecond, time.Hour, nil)
+	started := make(chan bool, 1)
+	var notifying int32
+	c.OnEvict(func(key, value int, reason EvictReason) {
+		if reason == EVICT_EXPIRED {
+			atomic.StoreInt32(&notifying, 1)
+			started <- true
+			time.Sleep(time.Millisecond * 50)
+			atomic.StoreInt32(&notifying, 0)
+		}
+	})
+	c.SetWithTTL(1, 1, time.Millisecond)
+	c.Set(2, 2)
+	<-started
+	if err := c.Close(); err != nil || atomic.LoadInt32(&notifying) != 0 {
+		t.Fatal("close must wait for cleaner callbacks", err)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	c := clocktest.New(time.Now())
+	cache, err := NewTyped[string, int](
+		WithInterval(time.Second), WithTTL(time.Minute), WithCapacity(2), WithPolicy(NewFIFOPolicy[string]),
+		WithClock(c), WithShards(1), WithStats(false),
+		WithLoader(func(ctx context.Context, key string) (int, error) { return len(key), nil }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if val, err := cache.GetOrLoad(context.Background(), "three", nil); err != nil || val != 5 {
+		t.Fatal("unexpected default loader result", val, err)
+	}
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	if _, check := cache.Get("three", nil); check || cache.Stats().Hits != 0 {
+		t.Fatal("expected evicted item and disabled stats", cache.Keys(), cache.Stats())
+	}
+	c.Advance(time.Minute + time.Second)
+	if cache.Len() != 0 {
+		t.Fatal("expected expired items, found", cache.Keys())
+	}
+	for _, opts := range [][]Option{
+		{WithTTL(time.Second)},
+		{WithPolicy(NewLRUPolicy[interface{}])},
+		{WithCapacity(-1)},
+		{WithShards(0)},
+		{WithExpirationMode(EXPIRE_SLIDING_MAX_AGE, 0)},
+		{WithCapacity(1), WithPolicy(NewLRUPolicy[string])},
+		{WithShards(4), WithCapacity(2)},
+		{WithShards(4), WithMaxCost(3)},
+	} {
+		if _, err := New(opts...); !errors.Is(err, ErrInvalidOption) {
+			t.Fatal("expected ErrInvalidOption, found", err)
+		}
+	}
+	if _, err := NewTyped[string, int](); err != nil {
+		t.Fatal(err)
+	}
+	// Ограничения сегментированного хранилища в сумме не превышают заданных
+	sharded, _ := NewTyped[int, int](WithShards(4), WithCapacity(10))
+	weighted, _ := NewTyped[int, int](WithShards(4), WithMaxCost(10))
+	for i := 0; i < 10000; i++ {
+		sharded.Set(i, i)
+		weighted.Set(i, i)
+	}
+	if sharded.Len() > 10 || weighted.Cost() > 10 {
+		t.Fatal("sharded limits exceeded", sharded.Len(), weighted.Cost())
+	}
+	// Позиционные конструкторы не проверяют параметры
+	NewCache(-time.Second, 0, nil).Close()
+	if _, err := cacher.Load("key", nil, nil); err != ErrNoLoader {
+		t.Fatal("expected ErrNoLoader, found", err)
+	}
+}
+
+func TestCacheClock(t *testing.T) {
+	c := clocktest.New(time.Now())
+	cache := NewTypedCache[int, int](time.Second, time.Second*10, nil)
+	cache.SetClock(c)
+	defer cache.Close()
+	cache.Set(1, 1)
+	cache.Set(2, 2)
+	c.Advance(time.Second * 5)
+	if _, check := cache.Get(1, nil); !check {
+		t.Fatal("expected item 1 before expiration")
+	}
+	c.Advance(time.Second * 6)
+	if cache.Len() != 1 {
+		t.Fatal("expected only touched item after 11s, found", cache.Keys())
+	}
+	// Обращение продлевает время жизни на ttl от прежнего срока (до 20s)
+	c.Advance(time.Second * 10)
+	if cache.Len() != 0 {
+		t.Fatal("expected empty cache after 21s, found", cache.Keys())
+	}
+}
+
+func TestFileCheckInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "object")
+	if err := os.WriteFile(path, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := clocktest.New(time.Now())
+	f := NewFileObject(path, func(src []byte, store func(interface{})) error {
+		store(string(src))
+		return nil
+	})
+	f.SetClock(c)
+	f.SetCheckInterval(time.Minute)
+	if val, err := f.Get(); err != nil || val != "first" {
+		t.Fatal("unexpected file value", val, err)
+	}
+	if err := os.WriteFile(path, []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(time.Hour)
+	os.Chtimes(path, mod, mod)
+	if val, _ := f.Get(); val != "first" {
+		t.Fatal("file must not be checked before interval, found", val)
+	}
+	c.Advance(time.Minute)
+	if val, _ := f.Get(); val != "second" || f.Reloads() != 2 {
+		t.Fatal("expected reloaded file value, found", val, f.Reloads())
+	}
+}
+
+func TestFileParseErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map")
+	if err := os.WriteFile(path, []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFileMap(path, func(src []byte, store func(interface{}, interface{})) error {
+		return errors.New("parse failed")
+	})
+	if _, err := f.Len(); err == nil || f.ParseErrors() != 1 || f.Reloads() != 0 {
+		t.Fatal("expected parse error", err, f.ParseErrors(), f.Reloads())
+	}
+	os.Remove(path)
+	if _, err := f.Len(); err == nil || f.ParseErrors() != 2 {
+		t.Fatal("expected stat error", err, f.ParseErrors())
+	}
+}
+
+func TestCacheExpiryQueue(t *testing.T) {
+	c := clocktest.New(time.Now())
+	cache, _ := NewTyped[int, int](WithInterval(time.Second), WithClock(c))
+	defer cache.Close()
+	for i := 0; i < 10; i++ {
+		cache.SetWithTTL(i, i, time.Duration(i+1)*time.Second)
+	}
+	cache.Set(100, 100)
+	c.Advance(time.Second * 3)
+	// Объект, к которому обратились, возвращается в очередь с продлённой отметкой
+	cache.Get(2, nil)
+	c.Advance(time.Second)
+	if _, check := cache.Get(2, nil); !check || cache.Len() != 9 {
+		t.Fatal("unexpected items after 4s", cache.Keys())
+	}
+	c.Advance(time.Second * 20)
+	if keys := cache.Keys(); len(keys) != 1 || keys[0] != 100 {
+		t.Fatal("expected only unlimited item, found", keys)
+	}
+}
+
+func TestCacheLazyExpiry(t *testing.T) {
+	c := clocktest.New(time.Now())
+	var expired []string
+	cache, err := NewTyped[string, int](
+		WithInterval(time.Hour), WithTTL(time.Second), WithClock(c),
+		WithOnEvict(func(key string, value int, reason EvictReason) {
+			if reason == EVICT_EXPIRED {
+				expired = append(expired, key)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	c.Advance(time.Second * 2)
+	if _, check := cache.Get("a", nil); check || cache.Len() != 2 || len(expired) != 0 {
+		t.Fatal("expired item must be a miss without removal", cache.Keys(), expired)
+	}
+	cache.SetRemoveExpiredOnGet(true)
+	if _, check := cache.Get("a", nil); check || cache.Len() != 1 || len(expired) != 1 || expired[0] != "a" {
+		t.Fatal("expired item must be removed on get", cache.Keys(), expired)
+	}
+	if val, check := cache.GetOrCreate("b", nil, func(key string) (string, int, bool) { return key, 3, true }); !check || val != 3 {
+		t.Fatal("expected created item instead of expired", val, check)
+	}
+	if stats := cache.Stats(); stats.Expirations != 2 || stats.Misses != 3 {
+		t.Fatal("unexpected stats", stats)
+	}
+}
+
+func TestCacheEachExpiry(t *testing.T) {
+	c := clocktest.New(time.Now())
+	var expired int32
+	cache, _ := NewTyped[string, int](WithInterval(time.Hour), WithTTL(time.Second), WithClock(c),
+		WithOnEvict(func(key string, value int, reason EvictReason) {
+			if reason == EVICT_EXPIRED {
+				atomic.AddInt32(&expired, 1)
+			}
+		}))
+	defer cache.Close()
+	cache.Set("a", 1)
+	c.Advance(time.Second * 2)
+	all := func(int) bool { return true }
+	if val, check := cache.Each("", all, nil); check || cache.Len() != 1 {
+		t.Fatal("expired item must not be found by Each", val, check)
+	}
+	cache.SetRemoveExpiredOnGet(true)
+	if _, check := cache.Each("", all, nil); check || cache.Len() != 0 || expired != 1 {
+		t.Fatal("expired item must be removed by Each", cache.Keys(), expired)
+	}
+}
+
+func TestCacheRefreshAhead(t *testing.T) {
+	c := clocktest.New(time.Now())
+	var version, fail int32
+	cache, err := NewTyped[string, int32](
+		WithInterval(time.Hour), WithTTL(time.Second*10), WithExpirationMode(EXPIRE_ABSOLUTE, 0), WithClock(c),
+		WithRefreshAhead(time.Second*3), WithStaleWhileRevalidate(time.Second*5),
+		WithLoader(func(ctx context.Context, key string) (int32, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return 0, errors.New("load error")
+			}
+			return atomic.AddInt32(&version, 1), nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	// Ожидание завершения фонового обновления объекта
+	waitValue := func(expected int32) {
+		for i := 0; i < 100; i++ {
+			if val, _ := cache.Get("key", nil); val == expected {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		t.Fatal("expected refreshed value", expected)
+	}
+	cache.Set("key", 0)
+	c.Advance(time.Second * 8)
+	if val, check := cache.Get("key", nil); !check || val != 0 {
+		t.Fatal("expected current value within refresh window", val, check)
+	}
+	waitValue(1)
+	atomic.StoreInt32(&fail, 1)
+	c.Advance(time.Second * 11)
+	if val, check := cache.Get("key", nil); !check || val != 1 {
+		t.Fatal("expected stale value after failed refresh", val, check)
+	}
+	for i := 0; i < 100 && cache.Stats().LoadErrors == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if val, _ := cache.Get("key", nil); val != 1 || cache.Stats().LoadErrors == 0 {
+		t.Fatal("expected stale value and failed refresh in stats", val, cache.Stats())
+	}
+	c.Advance(time.Second * 5)
+	if _, check := cache.Get("key", nil); check {
+		t.Fatal("stale value must not be served after grace period")
+	}
+
+	// Загрузка не ожидает результата фонового обновления, начатого GetOrCreate
+	refreshed, _ := NewTyped[string, int32](WithInterval(time.Hour), WithTTL(time.Second*10), WithExpirationMode(EXPIRE_ABSOLUTE, 0),
+		WithClock(c), WithRefreshAhead(time.Second*3), WithErrorTTL(time.Minute))
+	defer refreshed.Close()
+	started, release := make(chan bool), make(chan bool)
+	refreshed.Set("key", 0)
+	c.Advance(time.Second * 8)
+	refreshed.GetOrCreate("key", nil, func(key string) (string, int32, bool) {
+		started <- true
+		<-release
+		return key, 0, false
+	})
+	<-started
+	c.Advance(time.Second * 5)
+	val, err := refreshed.GetOrLoad(context.Background(), "key", func(ctx context.Context, key string) (int32, error) {
+		return 42, nil
+	})
+	close(release)
+	if err != nil || val != 42 {
+		t.Fatal("expected value from own loader", val, err)
+	}
+}
+
+func TestCacheBulk(t *testing.T) {
+	cache, _ := NewTyped[int, string](WithShards(4))
+	defer cache.Close()
+	items := make(map[int]string)
+	for i := 0; i < 10; i++ {
+		items[i] = fmt.Sprint(i)
+	}
+	cache.SetMany(items)
+	if res := cache.GetMany([]int{1, 5, 20}, nil); len(res) != 2 || res[5] != "5" {
+		t.Fatal("unexpected GetMany result", res)
+	}
+	if count := cache.DeleteMany([]int{0, 1, 2, 30}); count != 3 || cache.Len() != 7 {
+		t.Fatal("unexpected DeleteMany result", count, cache.Keys())
+	}
+	var calls int
+	loader := func(keys []int) (map[int]string, error) {
+		calls++
+		if len(keys) != 2 {
+			t.Fatal("expected only missing keys in loader, found", keys)
+		}
+		return map[int]string{keys[0]: "loaded", keys[1]: "loaded"}, nil
+	}
+	res, err := cache.GetOrCreateMany([]int{1, 2, 3, 2}, nil, loader)
+	if err != nil || len(res) != 3 || res[1] != "loaded" || res[3] != "3" || calls != 1 {
+		t.Fatal("unexpected GetOrCreateMany result", res, err, calls)
+	}
+	if res, err = cache.GetOrCreateMany([]int{1, 2}, nil, loader); err != nil || len(res) != 2 || calls != 1 {
+		t.Fatal("loaded items must be stored", res, err, calls)
+	}
+	if _, err = cache.GetOrCreateMany([]int{40, 41}, nil, func(keys []int) (map[int]string, error) {
+		return nil, errors.New("load error")
+	}); err == nil {
+		t.Fatal("expected loader error")
+	}
+}
+
+func TestCacheRange(t *testing.T) {
+	var deleted int32
+	cache, _ := NewTyped[string, int](WithShards(4), WithOnEvict(func(key string, value int, reason EvictReason) {
+		if reason == EVICT_DELETED {
+			atomic.AddInt32(&deleted, 1)
+		}
+	}))
+	defer cache.Close()
+	for i := 0; i < 20; i++ {
+		cache.Set(fmt.Sprintf("tenant%d:%d", i%2, i), i)
+	}
+	sum, count := 0, 0
+	cache.Range(func(key string, value int) bool {
+		// Обращение к хранилищу во время обхода допустимо
+		cache.Get(key, nil)
+		sum += value
+		count++
+		return true
+	})
+	if count != 20 || sum != 190 {
+		t.Fatal("unexpected range result", count, sum)
+	}
+	count = 0
+	cache.Range(func(key string, value int) bool {
+		count++
+		return count < 5
+	})
+	if count != 5 {
+		t.Fatal("range must stop when callback returns false, calls", count)
+	}
+	if removed := cache.RemoveIf(func(key string, value int) bool {
+		return strings.HasPrefix(key, "tenant1:")
+	}); removed != 10 || deleted != 10 {
+		t.Fatal("unexpected RemoveIf result", removed, deleted)
+	}
+	snapshot := cache.Snapshot()
+	if len(snapshot) != 10 || snapshot["tenant0:4"] != 4 {
+		t.Fatal("unexpected snapshot", snapshot)
+	}
+}
+
+func TestCacheTags(t *testing.T) {
+	var invalidated int32
+	cache, _ := NewTyped[string, string](WithShards(4), WithOnEvict(func(key, value string, reason EvictReason) {
+		if reason == EVICT_INVALIDATED {
+			atomic.AddInt32(&invalidated, 1)
+		}
+	}))
+	defer cache.Close()
+	cache.SetWithTags("/", "index", "row:1", "row:2")
+	cache.SetWithTags("/about", "about", "row:2")
+	cache.SetWithTags("/news", "news", "row:3")
+	cache.Set("/static", "static")
+	if count := cache.InvalidateTag("row:2"); count != 2 || invalidated != 2 || cache.Len() != 2 {
+		t.Fatal("unexpected invalidation result", count, invalidated, cache.Keys())
+	}
+	if count := cache.InvalidateTag("row:1"); count != 0 {
+		t.Fatal("tag index must be cleared with removed items, found", count)
+	}
+	// Замена объекта без тегов исключает его из индекса
+	cache.Set("/news", "news")
+	if count := cache.InvalidateTag("row:3"); count != 0 || cache.Len() != 2 {
+		t.Fatal("replaced item must lose its tags", count, cache.Keys())
+	}
+
+	// Фоновое обновление объекта сохраняет его теги
+	c := clocktest.New(time.Now())
+	var version int32
+	refreshed, _ := NewTyped[string, int32](WithInterval(time.Hour), WithTTL(time.Second*10), WithExpirationMode(EXPIRE_ABSOLUTE, 0),
+		WithRefreshAhead(time.Second*3), WithLoader(func(ctx context.Context, key string) (int32, error) {
+			return atomic.AddInt32(&version, 1), nil
+		}))
+	defer refreshed.Close()
+	refreshed.SetWithTags("get", 0, "row")
+	refreshed.SetWithTags("create", 0, "row")
+	c.Advance(time.Second * 8)
+	refreshed.Get("get", nil)
+	refreshed.GetOrCreate("create", nil, func(key string) (string, int32, bool) {
+		return key, atomic.AddInt32(&version, 1), true
+	})
+	for i := 0; i < 100; i++ {
+		if a, _ := refreshed.Get("get", nil); a != 0 {
+			if b, _ := refreshed.Get("create", nil); b != 0 {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if count := refreshed.InvalidateTag("row"); count != 2 || refreshed.Len() != 0 {
+		t.Fatal("refreshed items must keep their tags", count, refreshed.Keys())
+	}
+}
+
+func TestPrefixCache(t *testing.T) {
+	c := clocktest.New(time.Now())
+	cache, err := NewPrefixCache[int](WithShards(4), WithInterval(time.Second), WithClock(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	for i := 0; i < 3; i++ {
+		cache.Set(fmt.Sprintf("user:4%d:profile", i), i)
+		cache.Set(fmt.Sprintf("user:4%d:settings", i), i)
+	}
+	cache.Set("user:4", 4)
+	cache.SetWithTTL("user:42:session", 42, time.Second)
+	if keys := cache.KeysWithPrefix("user:42:"); strings.Join(keys, ",") != "user:42:profile,user:42:session,user:42:settings" {
+		t.Fatal("unexpected keys with prefix", keys)
+	}
+	c.Advance(time.Second * 2)
+	var keys []string
+	cache.RangePrefix("user:4", func(key string, value int) bool {
+		keys = append(keys, key)
+		return len(keys) < 4
+	})
+	if strings.Join(keys, ",") != "user:4,user:40:profile,user:40:settings,user:41:profile" {
+		t.Fatal("unexpected range prefix result", keys)
+	}
+	if count := cache.DeletePrefix("user:41"); count != 2 || cache.Len() != 5 {
+		t.Fatal("unexpected DeletePrefix result", count, cache.Keys())
+	}
+	if count := cache.DeletePrefix("user:"); count != 5 || cache.Len() != 0 || len(cache.KeysWithPrefix("")) != 0 {
+		t.Fatal("expected empty cache", count, cache.Keys())
+	}
+}
+
+func TestRadixTree(t *testing.T) {
+	tree, keys := new(radixTree), make(map[string]bool)
+	words := []string{"", "a", "ab", "abc", "abd", "b", "ba", "bad", "badge", "c", "ca", "cab", "abcd", "ab"}
+	for i := 0; i < 2000; i++ {
+		word := words[i*7%len(words)] + words[i*3%len(words)]
+		if i%3 == 0 {
+			tree.remove(word)
+			delete(keys, word)
+		} else {
+			tree.add(word)
+			keys[word] = true
+		}
+	}
+	for _, prefix := range append(words, "x", "abz") {
+		var expected, found []string
+		for key := range keys {
+			if strings.HasPrefix(key, prefix) {
+				expected = append(expected, key)
+			}
+		}
+		sort.Strings(expected)
+		tree.walkPrefix(prefix, func(key string) bool {
+			found = append(found, key)
+			return true
+		})
+		if strings.Join(expected, ",") != strings.Join(found, ",") || len(expected) != len(found) {
+			t.Fatal("unexpected keys with prefix", prefix, expected, found)
+		}
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	store := NewMemoryStore[string, int]()
+	store.Set("stored", 1)
+	cache, err := NewTieredCache[string, int](store, STORE_WRITE_THROUGH, 0, nil, WithCapacity(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created int
+	createCall := func(key string) (string, int, bool) {
+		created++
+		return key, 2, true
+	}
+	if _, err = NewTieredCache[string, int](nil, STORE_WRITE_THROUGH, 0, nil); !errors.Is(err, ErrInvalidOption) {
+		t.Fatal("expected ErrInvalidOption, found", err)
+	}
+	if val, err := cache.GetOrLoad(context.Background(), "stored", nil); err != nil || val != 1 {
+		t.Fatal("expected value from store without loader", val, err)
+	}
+	if _, err = cache.GetOrLoad(context.Background(), "missing", nil); err != ErrNoLoader {
+		t.Fatal("expected ErrNoLoader, found", err)
+	}
+	loaded, _ := NewTieredCache[string, int](store, STORE_WRITE_THROUGH, 0, nil,
+		WithLoader(func(ctx context.Context, key string) (int, error) { return len(key), nil }))
+	if val, err := loaded.GetOrLoad(context.Background(), "loaded", nil); err != nil || val != 6 {
+		t.Fatal("expected value from default loader", val, err)
+	}
+	loaded.Close()
+	store.Delete("loaded")
+	cache.Cache().Clear()
+	if val, check := cache.GetOrCreate("stored", nil, createCall); !check || val != 1 || created != 0 {
+		t.Fatal("expected value from store", val, check, created)
+	}
+	if val, check := cache.GetOrCreate("new", nil, createCall); !check || val != 2 || created != 1 {
+		t.Fatal("expected created value", val, check, created)
+	}
+	if val, _, _ := store.Get("new"); val != 2 {
+		t.Fatal("created value must be written through", val)
+	}
+	cache.Cache().Clear()
+	if val, check := cache.Get("new", nil); !check || val != 2 || cache.Cache().Len() != 1 {
+		t.Fatal("expected read-through value", val, check)
+	}
+	cache.Delete("new")
+	if _, check, _ := store.Get("new"); check {
+		t.Fatal("deleted value must be removed from store")
+	}
+	cache.Close()
+
+	// Поиск во внешнем хранилище не блокирует кэш первого уровня
+	slow := &slowStore{NewMemoryStore[string, int](), make(chan bool), make(chan bool)}
+	cache, _ = NewTieredCache[string, int](slow, STORE_WRITE_THROUGH, 0, nil)
+	cache.Set("fast", 1)
+	created = 0
+	go cache.GetOrCreate("slow", nil, createCall)
+	<-slow.started
+	if val, check := cache.Get("fast", nil); !check || val != 1 {
+		t.Fatal("expected cached value during store lookup", val, check)
+	}
+	close(slow.release)
+	if val, check := cache.GetOrCreate("slow", nil, createCall); !check || val != 2 || created != 1 {
+		t.Fatal("expected single created value", val, check, created)
+	}
+	cache.Close()
+
+	// Отложенная запись
+	c := clocktest.New(time.Now())
+	files, err := NewFileStore[int](t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewTieredCache[string, int](files, STORE_WRITE_BEHIND, 0, nil); !errors.Is(err, ErrInvalidOption) {
+		t.Fatal("expected ErrInvalidOption, found", err)
+	}
+	cache, _ = NewTieredCache[string, int](files, STORE_WRITE_BEHIND, time.Second, func(err error) { t.Error(err) }, WithClock(c))
+	cache.Set("user:1/..", 1)
+	cache.Set("user:2", 2)
+	cache.Delete("user:2")
+	if _, check, _ := files.Get("user:1/.."); check {
+		t.Fatal("write-behind value must not be stored before flush")
+	}
+	cache.Cache().Clear()
+	if val, check := cache.Get("user:1/..", nil); !check || val != 1 {
+		t.Fatal("pending value must be readable", val, check)
+	}
+	c.Advance(time.Second)
+	if val, check, err := files.Get("user:1/.."); !check || val != 1 || err != nil {
+		t.Fatal("expected flushed value", val, check, err)
+	}
+	cache.Set("user:3", 3)
+	if err = cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if val, check, _ := files.Get("user:3"); !check || val != 3 {
+		t.Fatal("pending value must be flushed on close", val, check)
+	}
+}
+
+func TestWriteBehindQueue(t *testing.T) {
+	var (
+		locker  sync.Mutex
+		batches [][]WriteOp[string, int]
+		fails   int
+	)
+	writer := TypedWriterFunc[string, int](func(batch []WriteOp[string, int]) error {
+		locker.Lock()
+		defer locker.Unlock()
+		if fails > 0 {
+			fails--
+			return errors.New("write failed")
+		}
+		batches = append(batches, append([]WriteOp[string, int](nil), batch...))
+		return nil
+	})
+	written := func() int {
+		locker.Lock()
+		defer locker.Unlock()
+		return len(batches)
+	}
+	if _, err := NewWriteBehindQueue[string, int](writer, WriteBehindConfig{}); !errors.Is(err, ErrInvalidOption) {
+		t.Fatal("expected ErrInvalidOption, found", err)
+	}
+	c := clocktest.New(time.Now())
+	queue, _ := NewWriteBehindQueue[string, int](writer, WriteBehindConfig{BatchSize: 3, Interval: time.Second, Retries: 1, Clock: c})
+
+	// Операции с одним ключом объединяются
+	queue.Set("a", 1)
+	queue.Set("b", 2)
+	queue.Set("a", 3)
+	queue.Delete("b")
+	if op, check := queue.Get("a"); !check || op.Value != 3 || queue.Len() != 2 {
+		t.Fatal("expected coalesced write", op, check, queue.Len())
+	}
+	c.Advance(time.Second)
+	if written() != 1 || len(batches[0]) != 2 || batches[0][0] != (WriteOp[string, int]{Key: "a", Value: 3}) || !batches[0][1].Delete {
+		t.Fatal("unexpected batch", batches)
+	}
+
+	// Достижение размера пакета запускает запись без ожидания интервала
+	for i := 0; i < 3; i++ {
+		queue.Set(fmt.Sprint(i), i)
+	}
+	for written() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Ошибка записи: повторная попытка, затем возврат операций в очередь
+	fails = 1
+	queue.Set("c", 1)
+	if err := queue.Flush(); err != nil || written() != 3 {
+		t.Fatal("expected successful retry", err, written())
+	}
+	fails = 2
+	queue.Set("d", 1)
+	if err := queue.Flush(); err == nil || queue.Len() != 1 {
+		t.Fatal("failed write must stay in queue", err, queue.Len())
+	}
+	if err := queue.Close(); err != nil || written() != 4 || batches[3][0].Key != "d" {
+		t.Fatal("pending writes must be flushed on close", err, written())
+	}
+	if err := queue.Set("e", 1); err != ErrClosed {
+		t.Fatal("expected ErrClosed, found", err)
+	}
+
+	// Задержка повторных попыток отсчитывается по часам очереди
+	queue, _ = NewWriteBehindQueue[string, int](writer, WriteBehindConfig{BatchSize: 10, Retries: 2, RetryDelay: time.Second, Clock: c})
+	locker.Lock()
+	fails = 2
+	locker.Unlock()
+	queue.Set("f", 1)
+	flushed := make(chan error, 1)
+	go func() { flushed <- queue.Flush() }()
+	for _, delay := range []time.Duration{time.Second, time.Second * 2} {
+		for c.Tickers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		c.Advance(delay)
+	}
+	if err := <-flushed; err != nil || written() != 5 {
+		t.Fatal("expected write after delayed retries", err, written())
+	}
+	queue.Close()
+
+	// Повторная попытка записи, запущенной сигналом тикера, отсчитывается следующим переводом часов
+	queue, _ = NewWriteBehindQueue[string, int](writer, WriteBehindConfig{Interval: time.Second, Retries: 1, RetryDelay: time.Second, Clock: c})
+	locker.Lock()
+	fails = 1
+	locker.Unlock()
+	queue.Set("g", 1)
+	c.Advance(time.Second)
+	c.Advance(time.Second)
+	for i := 0; i < 100 && written() != 6; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if written() != 6 || queue.Len() != 0 {
+		t.Fatal("expected write after retry on tick", written(), queue.Len())
+	}
+
+	queue.Close()
+
+	// Закрытие прерывает ожидание повторной попытки
+	queue, _ = NewWriteBehindQueue[string, int](writer, WriteBehindConfig{Interval: time.Second, Retries: 2, RetryDelay: time.Hour, Clock: c})
+	locker.Lock()
+	fails = 2
+	locker.Unlock()
+	queue.Set("h", 1)
+	c.Advance(time.Second)
+	if err := queue.Close(); err != nil || written() != 7 {
+		t.Fatal("close must not wait for retry delay", err, written())
+	}
+
+	// Кэш с отложенной записью без хранилища для чтения
+	batches = nil
+	cache, err := NewWriteBehindCache[string, int](nil, writer, WriteBehindConfig{Interval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Set("counter", 1)
+	cache.Set("counter", 2)
+	cache.Cache().Clear()
+	if val, check := cache.Get("counter", nil); !check || val != 2 {
+		t.Fatal("pending value must be readable", val, check)
+	}
+	if val, check := cache.Get("missing", nil); check {
+		t.Fatal("unexpected value", val)
+	}
+	if err = cache.Close(); err != nil || written() != 1 || len(batches[0]) != 1 {
+		t.Fatal("expected single coalesced write on close", err, batches)
+	}
+}
+
+// Хранилище, поиск в котором ожидает разрешения теста
+type slowStore struct {
+	*MemoryStore[string, int]
+	started, release chan bool
+}
+
+func (s *slowStore) Get(key string) (int, bool, error) {
+	s.started <- true
+	<-s.release
+	return s.MemoryStore.Get(key)
+}
+
+// Время работы клинера не зависит от общего количества объектов в хранилище
+func BenchmarkCacheCleaner(b *testing.B) {
+	for _, size := range []int{1000, 100000, 1000000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			c := clocktest.New(time.Now())
+			cache, _ := NewTyped[int, int](WithInterval(time.Second), WithTTL(time.Hour), WithClock(c), WithStats(false))
+			defer cache.Close()
+			for i := 0; i < size; i++ {
+				cache.Set(i, i)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < 10; j++ {
+					cache.SetWithTTL(-j-1, j, time.Millisecond)
+				}
+				c.Advance(time.Second)
+			}
+		})
+	}
+}
+
 func TestFile(t *testing.T) {
 	for i := 0; i < 500; i++ {
 		go func() {